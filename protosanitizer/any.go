@@ -0,0 +1,153 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const anyName = "google.protobuf.Any"
+
+// isAny checks whether the message is a google.protobuf.Any.
+func isAny(md protoreflect.MessageDescriptor) bool {
+	return md.FullName() == anyName
+}
+
+// unpackAny returns the type URL and the embedded message of a
+// google.protobuf.Any. The message type is looked up in the types
+// set with WithMessageTypes first, then in the APIv2 registry and
+// finally among the types registered with golang/protobuf.
+// The message is a Go struct generated for APIv1 or an APIv2 message,
+// so it can be passed to value.
+func (r *secretRules) unpackAny(m protoreflect.Message) (url string, payload interface{}, err error) {
+	fields := m.Descriptor().Fields()
+	url = m.Get(fields.ByNumber(1)).String()
+	value := m.Get(fields.ByNumber(2)).Bytes()
+	name := url[strings.LastIndexByte(url, '/')+1:]
+
+	var msg protov2.Message
+	if mt, err := r.findMessageByURL(url); err == nil {
+		msg = mt.New().Interface()
+		payload = msg
+	} else if t := proto.MessageType(name); t != nil && t.Kind() == reflect.Ptr {
+		v1 := reflect.New(t.Elem()).Interface().(proto.Message)
+		msg = protoimpl.X.ProtoMessageV2Of(v1)
+		payload = v1
+	} else {
+		return url, nil, fmt.Errorf("unknown message type %q", name)
+	}
+	if err := protov2.Unmarshal(value, msg); err != nil {
+		return url, nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return url, payload, nil
+}
+
+func (r *secretRules) findMessageByURL(url string) (protoreflect.MessageType, error) {
+	if r.types != nil {
+		if mt, err := r.types.FindMessageByURL(url); err == nil {
+			return mt, nil
+		}
+	}
+	return protoregistry.GlobalTypes.FindMessageByURL(url)
+}
+
+// reflectPayload returns the APIv2 view of a message returned by unpackAny.
+func reflectPayload(payload interface{}) protoreflect.Message {
+	if msg, ok := payload.(protov2.Message); ok {
+		return msg.ProtoReflect()
+	}
+	return protoimpl.X.MessageOf(payload)
+}
+
+// anyMessage serializes a google.protobuf.Any as a JSON object with
+// the type URL under "@type" and the sanitized embedded message under
+// "value". If the embedded message cannot be inspected, the value is
+// replaced with a marker.
+func (e *encoder) anyMessage(m protoreflect.Message) {
+	url, payload, err := e.rules.unpackAny(m)
+	e.buf.WriteString(`{"@type":`)
+	e.string(url)
+	e.buf.WriteString(`,"value":`)
+	if err != nil {
+		e.stripped(err)
+	} else {
+		e.value(reflect.ValueOf(payload))
+	}
+	e.buf.WriteByte('}')
+}
+
+// protoJSONAny serializes a google.protobuf.Any like protojson: the
+// fields of the embedded message are stored next to "@type", except
+// for well-known types, which are stored under "value".
+func (e *encoder) protoJSONAny(m protoreflect.Message) {
+	url, payload, err := e.rules.unpackAny(m)
+	e.buf.WriteString(`{"@type":`)
+	e.string(url)
+	mark := e.buf.Len()
+	e.buf.WriteString(`,"value":`)
+	switch {
+	case err != nil:
+		e.stripped(err)
+	case !e.protoJSONWellKnown(reflectPayload(payload)):
+		e.buf.Truncate(mark)
+		e.protoJSONFields(reflectPayload(payload), false)
+	}
+	e.buf.WriteByte('}')
+}
+
+// treeAny writes a google.protobuf.Any as a message with "@type"
+// and "value" fields.
+func (e *encoder) treeAny(m protoreflect.Message) {
+	url, payload, err := e.rules.unpackAny(m)
+	e.tree.scalar(e, treeKey{name: "@type", index: -1}, text(url))
+	k := treeKey{name: "value", index: -1}
+	if err != nil {
+		e.tree.scalar(e, k, text(fmt.Sprintf("***stripped: %s***", err)))
+		return
+	}
+	e.treeNested(k, reflectPayload(payload))
+}
+
+// sanitizeAny sanitizes the embedded message of a google.protobuf.Any.
+// The entire value gets removed if it cannot be inspected.
+func (r *secretRules) sanitizeAny(m protoreflect.Message, wipe bool) {
+	valueField := m.Descriptor().Fields().ByNumber(2)
+	old := m.Get(valueField).Bytes()
+	_, payload, err := r.unpackAny(m)
+	var data []byte
+	if err == nil {
+		msg := reflectPayload(payload)
+		r.sanitize(msg, wipe)
+		data, err = protov2.Marshal(msg.Interface())
+	}
+	if wipe {
+		zeroValue(valueField, protoreflect.ValueOfBytes(old))
+	}
+	if err != nil {
+		m.Clear(valueField)
+		return
+	}
+	m.Set(valueField, protoreflect.ValueOfBytes(data))
+}
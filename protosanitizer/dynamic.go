@@ -0,0 +1,125 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"fmt"
+	"strings"
+
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DescriptorSet provides messages for the types in a serialized
+// FileDescriptorSet, without generated Go code. This is useful for
+// tools like a debugging proxy which must handle whatever version of
+// the CSI spec or vendor extensions a driver uses. The messages can
+// be passed to StripSecrets and the other functions of this package,
+// which read the csi_secret option from the loaded descriptors.
+type DescriptorSet struct {
+	files *protoregistry.Files
+	types *dynamicpb.Types
+}
+
+// LoadDescriptorSet parses a FileDescriptorSet, for example one
+// created with "protoc --include_imports --descriptor_set_out". Files
+// must come after the files they import. Imports which are not in
+// the set are looked up among the files compiled into the binary,
+// like google/protobuf/descriptor.proto.
+func LoadDescriptorSet(data []byte) (*DescriptorSet, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := protov2.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("parse descriptor set: %v", err)
+	}
+	files := &protoregistry.Files{}
+	for _, fdp := range set.File {
+		file, err := protodesc.NewFile(fdp, fallbackResolver{files})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fdp.GetName(), err)
+		}
+		if err := files.RegisterFile(file); err != nil {
+			return nil, fmt.Errorf("%s: %v", fdp.GetName(), err)
+		}
+	}
+	return &DescriptorSet{files: files, types: dynamicpb.NewTypes(files)}, nil
+}
+
+// Files returns the files of the set.
+func (d *DescriptorSet) Files() *protoregistry.Files {
+	return d.files
+}
+
+// Types returns the message, enum and extension types of the set.
+// They can be passed to WithMessageTypes so that messages of the set
+// which are embedded in google.protobuf.Any get sanitized.
+func (d *DescriptorSet) Types() *dynamicpb.Types {
+	return d.types
+}
+
+// Unmarshal decodes a message of the type with the given full name,
+// for example "csi.v1.CreateVolumeRequest".
+func (d *DescriptorSet) Unmarshal(name protoreflect.FullName, data []byte) (protov2.Message, error) {
+	mt, err := d.types.FindMessageByName(name)
+	if err != nil {
+		return nil, err
+	}
+	msg := mt.New().Interface()
+	if err := (protov2.UnmarshalOptions{Resolver: d.types}).Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return msg, nil
+}
+
+// Method looks up a gRPC method by the name used on the wire, for
+// example "/csi.v1.Controller/CreateVolume". Input and Output of
+// the result are the types of the request and response.
+func (d *DescriptorSet) Method(fullMethod string) (protoreflect.MethodDescriptor, error) {
+	name := strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1)
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, err
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+	return method, nil
+}
+
+// fallbackResolver finds the imports of a file in the set that is
+// being loaded and, if not there, in the global registry.
+type fallbackResolver struct {
+	files *protoregistry.Files
+}
+
+func (r fallbackResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if file, err := r.files.FindFileByPath(path); err == nil {
+		return file, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r fallbackResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if desc, err := r.files.FindDescriptorByName(name); err == nil {
+		return desc, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
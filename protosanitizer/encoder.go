@@ -0,0 +1,581 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// encoder produces the same one-line JSON as encoding/json for
+// the Go structs generated by golang/protobuf, except that secret
+// fields are replaced while walking the message.
+type encoder struct {
+	buf      *bytes.Buffer
+	rules    *secretRules
+	strict   bool
+	format   Format
+	redactor Redactor
+	maxSize  int
+	maxDepth int
+	depth    int
+	err      error
+	scratch  [64]byte
+
+	maxEntries      int
+	maxStringLength int
+	heuristics      *heuristics
+
+	// tree is set for the formats which are based on treeFormat.
+	tree treeFormat
+
+	// w, if set, receives the output in chunks while serializing.
+	// written counts the bytes passed to it, werr is the first
+	// error returned by it.
+	w       io.Writer
+	written int64
+	werr    error
+}
+
+// encoderFunc serializes a value which contains no messages.
+type encoderFunc func(e *encoder, v reflect.Value)
+
+// value serializes an arbitrary value passed to StripSecrets.
+func (e *encoder) value(v reflect.Value) {
+	if !v.IsValid() {
+		e.buf.WriteString("null")
+		return
+	}
+	if m, ok := v.Interface().(protov2.Message); ok {
+		e.reflectMessage(m.ProtoReflect())
+		return
+	}
+	t := v.Type()
+	switch {
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && t.Implements(descriptorMessageType):
+		e.message(v)
+	case t.Implements(protoMessageType) && e.strict:
+		e.stripped(fmt.Errorf("no descriptor for %s", t))
+	default:
+		e.marshal(v)
+	}
+}
+
+// message serializes a pointer to a generated message struct.
+func (e *encoder) message(v reflect.Value) {
+	if v.IsNil() {
+		e.buf.WriteString("null")
+		return
+	}
+	if !e.enter() {
+		return
+	}
+	plan := e.rules.plan(v.Type().Elem())
+	if plan.wellKnown {
+		e.wellKnown(protoimpl.X.MessageOf(v.Interface()))
+		e.depth--
+		return
+	}
+	v = v.Elem()
+	e.buf.WriteByte('{')
+	first := true
+	for i := range plan.fields {
+		if e.stop() {
+			break
+		}
+		field := &plan.fields[i]
+		fv := v.Field(field.index)
+		if field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		if !first {
+			e.buf.WriteByte(',')
+		}
+		first = false
+		e.string(field.name)
+		e.buf.WriteByte(':')
+		e.field(field, fv)
+	}
+	e.buf.WriteByte('}')
+	e.depth--
+}
+
+func (e *encoder) field(field *fieldPlan, v reflect.Value) {
+	switch field.kind {
+	case secretField:
+		e.secret(v)
+	case messageField:
+		e.messages(v)
+	case keyedField:
+		e.keyedMap(field.keys, field.encode, v)
+	case oneofField:
+		if v.IsNil() || v.Elem().IsNil() {
+			e.buf.WriteString("null")
+			return
+		}
+		wrapper := v.Elem()
+		alternative := field.oneofs[wrapper.Type()]
+		if alternative == nil {
+			if e.strict {
+				e.stripped(fmt.Errorf("unknown oneof type %s", wrapper.Type()))
+			} else {
+				e.marshal(v)
+			}
+			return
+		}
+		e.buf.WriteByte('{')
+		e.string(alternative.name)
+		e.buf.WriteByte(':')
+		e.field(alternative, wrapper.Elem().Field(0))
+		e.buf.WriteByte('}')
+	case unknownField:
+		if e.strict {
+			e.stripped(field.err)
+			return
+		}
+		field.encode(e, v)
+	default:
+		field.encode(e, v)
+	}
+}
+
+// messages serializes a single message, a slice of messages
+// or a map with messages as values.
+func (e *encoder) messages(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		e.message(v)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return
+		}
+		e.buf.WriteByte('[')
+		n := e.entries(v.Len())
+		for i := 0; i < n; i++ {
+			if e.stop() {
+				break
+			}
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.message(v.Index(i))
+		}
+		e.moreEntries(v.Len()-n, false)
+		e.buf.WriteByte(']')
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return
+		}
+		keys := sortedKeys(v)
+		n := e.entries(len(keys))
+		e.buf.WriteByte('{')
+		for i, key := range keys[:n] {
+			if e.stop() {
+				break
+			}
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.string(key.name)
+			e.buf.WriteByte(':')
+			e.message(v.MapIndex(key.value))
+		}
+		e.moreEntries(len(keys)-n, true)
+		e.buf.WriteByte('}')
+	}
+}
+
+// enter must be called before serializing the fields of a message
+// and, if it returns true, be followed by decrementing e.depth. It
+// returns false after writing a placeholder if the message is nested
+// too deeply.
+func (e *encoder) enter() bool {
+	if e.maxDepth > 0 && e.depth >= e.maxDepth {
+		e.string("...(max depth)")
+		return false
+	}
+	e.depth++
+	return true
+}
+
+// full returns true once the output is larger than the maximum size.
+// Serializing can stop at that point because truncate will remove
+// everything that comes after it.
+func (e *encoder) full() bool {
+	return e.maxSize > 0 && e.buf.Len() > e.maxSize
+}
+
+// stop is called before each field of a message and each entry of
+// a list or map. It returns true when serializing can stop, because
+// the output is full or writing it failed. When writing to w, it
+// also passes on the output once enough of it has accumulated.
+func (e *encoder) stop() bool {
+	if e.w != nil && e.werr == nil && e.buf.Len() >= flushSize {
+		e.flush()
+	}
+	return e.full() || e.werr != nil
+}
+
+// flush writes all buffered output except for the last byte to w.
+// The formats look at that byte to decide about separators.
+func (e *encoder) flush() {
+	b := e.buf.Bytes()
+	n, err := e.w.Write(b[:len(b)-1])
+	e.written += int64(n)
+	if err != nil {
+		e.werr = err
+		return
+	}
+	last := b[len(b)-1]
+	e.buf.Reset()
+	e.buf.WriteByte(last)
+}
+
+// truncate enforces the maximum size on the final output.
+func (e *encoder) truncate() {
+	if !e.full() {
+		return
+	}
+	b := e.buf.Bytes()
+	n := e.maxSize
+	// Don't split a multi-byte character.
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	e.buf.Truncate(n)
+	e.buf.WriteString("...(truncated)")
+}
+
+// entries returns how many of the n entries of a list or map
+// get serialized.
+func (e *encoder) entries(n int) int {
+	if e.maxEntries > 0 && n > e.maxEntries {
+		return e.maxEntries
+	}
+	return n
+}
+
+// moreEntries writes the placeholder for the entries of a list or,
+// if inMap is true, of a map which were left out. n may be zero, in
+// which case nothing gets written.
+func (e *encoder) moreEntries(n int, inMap bool) {
+	if n <= 0 {
+		return
+	}
+	// Entries are only left out when there is a limit, so there
+	// always is at least one entry before the placeholder.
+	e.buf.WriteByte(',')
+	if inMap {
+		e.buf.WriteString(`"...":`)
+	}
+	e.string(fmt.Sprintf("...(%d more entries)", n))
+}
+
+// stringValue writes the value of a string field, shortened
+// to the maximum string length and redacted if it looks like
+// a secret.
+func (e *encoder) stringValue(s string) {
+	if e.heuristicValue(s) {
+		return
+	}
+	s, suffix := e.shorten(s)
+	e.string(s + suffix)
+}
+
+// shorten enforces the maximum string length. It returns the part
+// of the string that gets included and the placeholder for the rest.
+func (e *encoder) shorten(s string) (string, string) {
+	if e.maxStringLength <= 0 || len(s) <= e.maxStringLength {
+		return s, ""
+	}
+	n := e.maxStringLength
+	// Don't split a multi-byte character.
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n], fmt.Sprintf("...(%d more bytes)", len(s)-n)
+}
+
+// bytesValue writes the value of a bytes field as base64 string,
+// shortened to the maximum string length.
+func (e *encoder) bytesValue(b []byte) {
+	more := 0
+	if e.maxStringLength > 0 && len(b) > e.maxStringLength {
+		more = len(b) - e.maxStringLength
+		b = b[:e.maxStringLength]
+	}
+	e.buf.WriteByte('"')
+	e.buf.WriteString(base64.StdEncoding.EncodeToString(b))
+	if more > 0 {
+		fmt.Fprintf(e.buf, "...(%d more bytes)", more)
+	}
+	e.buf.WriteByte('"')
+}
+
+// stripped writes the marker for a value that was removed
+// because of the error.
+func (e *encoder) stripped(err error) {
+	e.string(fmt.Sprintf("***stripped: %s***", err))
+}
+
+// plainEncoder picks the encoder for values of type t. Common types
+// in CSI messages are handled directly, everything else is passed
+// through encoding/json.
+func plainEncoder(t reflect.Type) encoderFunc {
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return (*encoder).marshal
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return func(e *encoder, v reflect.Value) {
+			e.stringValue(v.String())
+		}
+	case reflect.Bool:
+		return func(e *encoder, v reflect.Value) {
+			e.buf.Write(strconv.AppendBool(e.scratch[:0], v.Bool()))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(e *encoder, v reflect.Value) {
+			e.buf.Write(strconv.AppendInt(e.scratch[:0], v.Int(), 10))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(e *encoder, v reflect.Value) {
+			e.buf.Write(strconv.AppendUint(e.scratch[:0], v.Uint(), 10))
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return func(e *encoder, v reflect.Value) {
+				if v.IsNil() {
+					e.buf.WriteString("null")
+					return
+				}
+				e.bytesValue(v.Bytes())
+			}
+		}
+		elem := plainEncoder(t.Elem())
+		return func(e *encoder, v reflect.Value) {
+			if v.IsNil() {
+				e.buf.WriteString("null")
+				return
+			}
+			e.buf.WriteByte('[')
+			n := e.entries(v.Len())
+			for i := 0; i < n; i++ {
+				if e.stop() {
+					break
+				}
+				if i > 0 {
+					e.buf.WriteByte(',')
+				}
+				elem(e, v.Index(i))
+			}
+			e.moreEntries(v.Len()-n, false)
+			e.buf.WriteByte(']')
+		}
+	case reflect.Map:
+		if t.Key() == stringType && t.Elem() == stringType {
+			return func(e *encoder, v reflect.Value) {
+				if v.IsNil() {
+					e.buf.WriteString("null")
+					return
+				}
+				m := v.Interface().(map[string]string)
+				keys := make([]string, 0, len(m))
+				for key := range m {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				n := e.entries(len(keys))
+				e.buf.WriteByte('{')
+				for i, key := range keys[:n] {
+					if e.stop() {
+						break
+					}
+					if i > 0 {
+						e.buf.WriteByte(',')
+					}
+					e.string(key)
+					e.buf.WriteByte(':')
+					if !e.heuristicKey(key) {
+						e.stringValue(m[key])
+					}
+				}
+				e.moreEntries(len(keys)-n, true)
+				e.buf.WriteByte('}')
+			}
+		}
+		elem := plainEncoder(t.Elem())
+		return func(e *encoder, v reflect.Value) {
+			if v.IsNil() {
+				e.buf.WriteString("null")
+				return
+			}
+			keys := sortedKeys(v)
+			n := e.entries(len(keys))
+			e.buf.WriteByte('{')
+			for i, key := range keys[:n] {
+				if e.stop() {
+					break
+				}
+				if i > 0 {
+					e.buf.WriteByte(',')
+				}
+				e.string(key.name)
+				e.buf.WriteByte(':')
+				if !e.heuristicKey(key.name) {
+					elem(e, v.MapIndex(key.value))
+				}
+			}
+			e.moreEntries(len(keys)-n, true)
+			e.buf.WriteByte('}')
+		}
+	}
+	return (*encoder).marshal
+}
+
+// marshal serializes a value with encoding/json.
+func (e *encoder) marshal(v reflect.Value) {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		if e.err == nil {
+			e.err = err
+		}
+		return
+	}
+	e.buf.Write(b)
+}
+
+const hex = "0123456789abcdef"
+
+// string writes a JSON string with the same escaping as encoding/json.
+func (e *encoder) string(s string) {
+	e.buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			e.buf.WriteString(s[start:i])
+			switch b {
+			case '\\', '"':
+				e.buf.WriteByte('\\')
+				e.buf.WriteByte(b)
+			case '\b':
+				e.buf.WriteString(`\b`)
+			case '\f':
+				e.buf.WriteString(`\f`)
+			case '\n':
+				e.buf.WriteString(`\n`)
+			case '\r':
+				e.buf.WriteString(`\r`)
+			case '\t':
+				e.buf.WriteString(`\t`)
+			default:
+				// Control characters and characters
+				// that are special in HTML.
+				e.buf.WriteString(`\u00`)
+				e.buf.WriteByte(hex[b>>4])
+				e.buf.WriteByte(hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			e.buf.WriteString(s[start:i])
+			e.buf.WriteString("\ufffd")
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			e.buf.WriteString(s[start:i])
+			e.buf.WriteString(`\u202`)
+			e.buf.WriteByte(hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	e.buf.WriteString(s[start:])
+	e.buf.WriteByte('"')
+}
+
+type mapKey struct {
+	name  string
+	value reflect.Value
+}
+
+// sortedKeys returns the keys of a protobuf map (string, integer or
+// bool keys) sorted by their JSON representation.
+func sortedKeys(v reflect.Value) []mapKey {
+	keys := make([]mapKey, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		var name string
+		switch key.Kind() {
+		case reflect.String:
+			name = key.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			name = strconv.FormatInt(key.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			name = strconv.FormatUint(key.Uint(), 10)
+		default:
+			name = fmt.Sprint(key.Interface())
+		}
+		keys = append(keys, mapKey{name, key})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
+
+// isEmptyValue is the same check as in encoding/json for omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
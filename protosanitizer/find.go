@@ -0,0 +1,139 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// FieldPath identifies a value inside a message, using the field
+// names from the .proto file. Entries of repeated fields and maps are
+// selected with brackets, with string keys in double quotes:
+//
+//	volume_capabilities[1].array_secret
+//	secrets["secret-abc"]
+//
+// The message embedded in a google.protobuf.Any is called "value".
+type FieldPath string
+
+// FindSecrets returns the paths of all secret values which are set in
+// the message, without revealing the values themselves. Secrets are
+// found the same way as in StripSecrets. Each entry of a secret map
+// or repeated field is reported separately. If a google.protobuf.Any
+// cannot be inspected, its entire value is reported.
+func FindSecrets(msg proto.Message) []FieldPath {
+	return defaultSanitizer.FindSecrets(msg)
+}
+
+// FindSecrets is like the package level FindSecrets, except that the
+// secret predicate and paths of the sanitizer are used.
+func (s *Sanitizer) FindSecrets(msg proto.Message) []FieldPath {
+	if msg == nil {
+		return nil
+	}
+	return s.rules.findSecrets(protoimpl.X.MessageOf(msg), "", nil)
+}
+
+// IsSecretField checks whether StripSecrets and FindSecrets treat
+// the field as secret. It works for descriptors of any origin, for
+// example descriptors loaded from a .proto file at runtime.
+func IsSecretField(field protoreflect.FieldDescriptor) bool {
+	return defaultSanitizer.IsSecretField(field)
+}
+
+// IsSecretField is like the package level IsSecretField, except that
+// the secret predicate and paths of the sanitizer are used.
+func (s *Sanitizer) IsSecretField(field protoreflect.FieldDescriptor) bool {
+	return s.rules.reflectEntry(string(field.Name()), field).secret
+}
+
+// findSecrets appends the paths of the secrets in the message to
+// paths. The path of the message itself is prefix.
+func (r *secretRules) findSecrets(m protoreflect.Message, prefix string, paths []FieldPath) []FieldPath {
+	if !m.IsValid() {
+		return paths
+	}
+	if isAny(m.Descriptor()) {
+		_, payload, err := r.unpackAny(m)
+		if err != nil {
+			return append(paths, FieldPath(join(prefix, "value")))
+		}
+		return r.findSecrets(reflectPayload(payload), join(prefix, "value"), paths)
+	}
+	plan := r.protoJSONPlan(m.Descriptor())
+	for i := range plan.entries {
+		entry := &plan.entries[i]
+		field := entry.field
+		if !m.Has(field) {
+			continue
+		}
+		path := join(prefix, string(field.Name()))
+		v := m.Get(field)
+		switch {
+		case entry.secret && field.IsMap():
+			for _, key := range sortedMapKeys(field, v.Map(), false) {
+				paths = append(paths, FieldPath(path+mapIndex(field, key)))
+			}
+		case entry.secret && field.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				paths = append(paths, FieldPath(path+listIndex(i)))
+			}
+		case entry.secret:
+			paths = append(paths, FieldPath(path))
+		case field.IsMap():
+			mv := v.Map()
+			for _, key := range sortedMapKeys(field, mv, false) {
+				switch {
+				case entry.keys != nil && entry.keys.secret(key.String()):
+					paths = append(paths, FieldPath(path+mapIndex(field, key)))
+				case isMessage(field.MapValue()):
+					paths = r.findSecrets(mv.Get(key).Message(), path+mapIndex(field, key), paths)
+				}
+			}
+		case field.IsList() && isMessage(field):
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				paths = r.findSecrets(list.Get(i).Message(), path+listIndex(i), paths)
+			}
+		case isMessage(field):
+			paths = r.findSecrets(v.Message(), path, paths)
+		}
+	}
+	return paths
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func listIndex(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+func mapIndex(field protoreflect.FieldDescriptor, key protoreflect.MapKey) string {
+	if field.MapKey().Kind() == protoreflect.StringKind {
+		return "[" + strconv.Quote(key.String()) + "]"
+	}
+	return "[" + key.String() + "]"
+}
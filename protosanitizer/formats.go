@@ -0,0 +1,380 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// textFormat produces the protobuf text format on a single line,
+// like prototext.MarshalOptions{}.Format.
+type textFormat struct{}
+
+// key writes the field name and, for map entries, the start of the
+// entry up to the value.
+func (t *textFormat) key(e *encoder, k treeKey) {
+	if n := e.buf.Len(); n > 0 && e.buf.Bytes()[n-1] != '{' {
+		e.buf.WriteByte(' ')
+	}
+	e.buf.WriteString(k.name)
+	e.buf.WriteByte(':')
+	if k.mapKey != nil {
+		e.buf.WriteString("{key:")
+		t.value(e, *k.mapKey)
+		e.buf.WriteString(" value:")
+	}
+}
+
+func (t *textFormat) value(e *encoder, v treeValue) {
+	switch v.kind {
+	case literalValue:
+		e.buf.WriteString(v.text)
+	default:
+		e.buf.WriteByte('"')
+		for i := 0; i < len(v.text); i++ {
+			c := v.text[i]
+			switch {
+			case c == '"' || c == '\\':
+				e.buf.WriteByte('\\')
+				e.buf.WriteByte(c)
+			case c == '\n':
+				e.buf.WriteString(`\n`)
+			case c == '\r':
+				e.buf.WriteString(`\r`)
+			case c == '\t':
+				e.buf.WriteString(`\t`)
+			case c < 0x20 || c == 0x7f || (c >= 0x80 && v.kind == binaryValue):
+				// Octal escapes, like in golang/protobuf. UTF-8
+				// in strings is kept as it is.
+				e.buf.WriteByte('\\')
+				e.buf.WriteByte('0' + c>>6)
+				e.buf.WriteByte('0' + (c>>3)&7)
+				e.buf.WriteByte('0' + c&7)
+			default:
+				e.buf.WriteByte(c)
+			}
+		}
+		e.buf.WriteString(v.suffix)
+		e.buf.WriteByte('"')
+	}
+}
+
+func (t *textFormat) scalar(e *encoder, k treeKey, v treeValue) {
+	t.key(e, k)
+	t.value(e, v)
+	if k.mapKey != nil {
+		e.buf.WriteByte('}')
+	}
+}
+
+func (t *textFormat) beginMessage(e *encoder, k treeKey) {
+	t.key(e, k)
+	e.buf.WriteByte('{')
+}
+
+func (t *textFormat) endMessage(e *encoder, k treeKey) {
+	e.buf.WriteByte('}')
+	if k.mapKey != nil {
+		e.buf.WriteByte('}')
+	}
+}
+
+// Maps are repeated entries in the text format, so there is
+// nothing to do at the start and end of a map.
+func (t *textFormat) beginMap(e *encoder, k treeKey) {}
+func (t *textFormat) endMap(e *encoder, k treeKey)   {}
+
+// logfmtFormat produces one key=value pair for each scalar value,
+// with the path to the value as key.
+type logfmtFormat struct {
+	// path is the key of the current message.
+	path []byte
+	// lengths stores the length of path before each nested
+	// message or map.
+	lengths []int
+	// written counts the pairs, starts stores the count at the
+	// beginning of each nested message or map.
+	written int
+	starts  []int
+}
+
+func (l *logfmtFormat) push(k treeKey) {
+	l.lengths = append(l.lengths, len(l.path))
+	switch {
+	case k.mapKey != nil && logfmtKey(k.mapKey.text):
+		l.path = append(l.path, '.')
+		l.path = append(l.path, k.mapKey.text...)
+	case k.mapKey != nil:
+		l.path = append(l.path, '[')
+		l.path = appendLogfmtMapKey(l.path, k.mapKey.text)
+		l.path = append(l.path, ']')
+	default:
+		if len(l.path) > 0 {
+			l.path = append(l.path, '.')
+		}
+		l.path = append(l.path, k.name...)
+		if k.index >= 0 {
+			l.path = append(l.path, '[')
+			l.path = strconv.AppendInt(l.path, int64(k.index), 10)
+			l.path = append(l.path, ']')
+		}
+	}
+}
+
+func (l *logfmtFormat) pop() {
+	l.path = l.path[:l.lengths[len(l.lengths)-1]]
+	l.lengths = l.lengths[:len(l.lengths)-1]
+}
+
+func (l *logfmtFormat) pair(e *encoder, value string) {
+	if e.buf.Len() > 0 {
+		e.buf.WriteByte(' ')
+	}
+	e.buf.Write(l.path)
+	e.buf.WriteByte('=')
+	e.buf.WriteString(value)
+	l.written++
+}
+
+func (l *logfmtFormat) scalar(e *encoder, k treeKey, v treeValue) {
+	l.push(k)
+	switch v.kind {
+	case literalValue:
+		l.pair(e, v.text)
+	case binaryValue:
+		l.pair(e, base64.StdEncoding.EncodeToString([]byte(v.text))+v.suffix)
+	default:
+		s := v.text + v.suffix
+		if !logfmtValue(s) {
+			s = strconv.Quote(s)
+		}
+		l.pair(e, s)
+	}
+	l.pop()
+}
+
+func (l *logfmtFormat) beginMessage(e *encoder, k treeKey) {
+	l.push(k)
+	l.starts = append(l.starts, l.written)
+}
+
+func (l *logfmtFormat) endMessage(e *encoder, k treeKey) {
+	if l.written == l.starts[len(l.starts)-1] {
+		// Show that the message or map was set.
+		l.pair(e, "{}")
+	}
+	l.starts = l.starts[:len(l.starts)-1]
+	l.pop()
+}
+
+func (l *logfmtFormat) beginMap(e *encoder, k treeKey) { l.beginMessage(e, k) }
+func (l *logfmtFormat) endMap(e *encoder, k treeKey)   { l.endMessage(e, k) }
+
+// logfmtKey checks whether a map key can be appended to the
+// path as it is. Other keys get escaped and put into brackets,
+// so that a key with a dot cannot be confused with a nested field.
+func logfmtKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isASCIILetter(c) && !isASCIIDigit(c) && c != '_' && (i == 0 || c != '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// appendLogfmtMapKey escapes a map key like strconv.Quote, without
+// the surrounding quotes. Spaces, equal signs, quotes and closing
+// brackets are escaped as well because they would end the key.
+func appendLogfmtMapKey(dst []byte, s string) []byte {
+	q := strconv.Quote(s)
+	for i := 1; i < len(q)-1; i++ {
+		switch c := q[i]; {
+		case c == '\\' && q[i+1] == '"':
+			dst = append(dst, `\x22`...)
+			i++
+		case c == '\\':
+			dst = append(dst, c, q[i+1])
+			i++
+		case c == ' ':
+			dst = append(dst, `\x20`...)
+		case c == '=':
+			dst = append(dst, `\x3d`...)
+		case c == ']':
+			dst = append(dst, `\x5d`...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// logfmtValue checks whether a value can be used without quoting.
+func logfmtValue(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlFormat produces a YAML document with block collections.
+type yamlFormat struct {
+	// indent is the indentation of the keys in the current mapping.
+	indent int
+	// sameLine is true after writing the "- " of a list item.
+	sameLine bool
+	// indents and starts store the state at the beginning of each
+	// nested message or map.
+	indents []int
+	written int
+	starts  []int
+}
+
+// key starts a new line with the key, or the "- " of a list item.
+func (y *yamlFormat) key(e *encoder, k treeKey) {
+	y.written++
+	if k.index >= 0 {
+		if k.index == 0 {
+			y.newline(e)
+			y.scalarText(e, k.name)
+			e.buf.WriteByte(':')
+		}
+		e.buf.WriteByte('\n')
+		y.spaces(e)
+		e.buf.WriteString("- ")
+		y.sameLine = true
+		return
+	}
+	y.newline(e)
+	if k.mapKey != nil {
+		y.value(e, *k.mapKey)
+	} else {
+		y.scalarText(e, k.name)
+	}
+	e.buf.WriteByte(':')
+}
+
+func (y *yamlFormat) newline(e *encoder) {
+	if y.sameLine {
+		y.sameLine = false
+		return
+	}
+	if e.buf.Len() > 0 {
+		e.buf.WriteByte('\n')
+	}
+	y.spaces(e)
+}
+
+func (y *yamlFormat) spaces(e *encoder) {
+	for i := 0; i < y.indent; i++ {
+		e.buf.WriteByte(' ')
+	}
+}
+
+func (y *yamlFormat) value(e *encoder, v treeValue) {
+	switch v.kind {
+	case literalValue:
+		e.buf.WriteString(v.text)
+	case binaryValue:
+		e.string(base64.StdEncoding.EncodeToString([]byte(v.text)) + v.suffix)
+	default:
+		y.scalarText(e, v.text+v.suffix)
+	}
+}
+
+// scalarText writes a string, with double quotes (and the same
+// escaping as JSON) unless it is certain that the string cannot
+// be mistaken for something else.
+func (y *yamlFormat) scalarText(e *encoder, s string) {
+	if yamlPlain(s) {
+		e.buf.WriteString(s)
+		return
+	}
+	e.string(s)
+}
+
+func (y *yamlFormat) scalar(e *encoder, k treeKey, v treeValue) {
+	y.key(e, k)
+	if y.sameLine {
+		y.sameLine = false
+	} else {
+		e.buf.WriteByte(' ')
+	}
+	y.value(e, v)
+}
+
+func (y *yamlFormat) beginMessage(e *encoder, k treeKey) {
+	y.key(e, k)
+	y.indents = append(y.indents, y.indent)
+	y.starts = append(y.starts, y.written)
+	// The fields of a message in a list start on the same
+	// line as the "- ", indented by the same amount.
+	y.indent += 2
+}
+
+func (y *yamlFormat) endMessage(e *encoder, k treeKey) {
+	if y.written == y.starts[len(y.starts)-1] {
+		if y.sameLine {
+			y.sameLine = false
+		} else {
+			e.buf.WriteByte(' ')
+		}
+		e.buf.WriteString("{}")
+	}
+	y.indent = y.indents[len(y.indents)-1]
+	y.indents = y.indents[:len(y.indents)-1]
+	y.starts = y.starts[:len(y.starts)-1]
+}
+
+func (y *yamlFormat) beginMap(e *encoder, k treeKey) { y.beginMessage(e, k) }
+func (y *yamlFormat) endMap(e *encoder, k treeKey)   { y.endMessage(e, k) }
+
+// yamlPlain checks whether a string can be written as plain scalar
+// without changing its meaning. This is deliberately conservative.
+func yamlPlain(s string) bool {
+	if s == "" {
+		return false
+	}
+	if c := s[0]; !isASCIILetter(c) && c != '_' && c != '/' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isASCIILetter(c) && !isASCIIDigit(c) && !strings.ContainsRune("_-./", rune(c)) {
+			return false
+		}
+	}
+	switch strings.ToLower(s) {
+	case "y", "n", "yes", "no", "true", "false", "on", "off", "null":
+		return false
+	}
+	return true
+}
+
+func isASCIILetter(c byte) bool {
+	return isASCIILower(c | ' ')
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// defaultKeyPatterns are used by WithHeuristics when no patterns
+// are given.
+var defaultKeyPatterns = []string{"*password*", "*passwd*", "*token*", "*secret*", "*key*"}
+
+var (
+	jwtRE = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+	awsRE = regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)
+)
+
+// heuristics detects secrets in fields which are not annotated.
+type heuristics struct {
+	// keys are lower case glob patterns for map keys.
+	keys []string
+}
+
+func newHeuristics(keyPatterns []string) *heuristics {
+	if len(keyPatterns) == 0 {
+		keyPatterns = defaultKeyPatterns
+	}
+	h := &heuristics{}
+	for _, pattern := range keyPatterns {
+		h.keys = append(h.keys, strings.ToLower(pattern))
+	}
+	return h
+}
+
+// key returns the reason why values stored under the map key
+// are considered secret, or an empty string if they are not.
+func (h *heuristics) key(key string) string {
+	key = strings.ToLower(key)
+	for _, pattern := range h.keys {
+		if match(pattern, key) {
+			return "key pattern " + pattern + " matched"
+		}
+	}
+	return ""
+}
+
+// value returns the reason why a string is considered secret,
+// or an empty string if it is not.
+func (h *heuristics) value(s string) string {
+	switch {
+	case strings.Contains(s, "-----BEGIN "):
+		return "value looks like a PEM block"
+	case strings.Contains(s, "eyJ") && jwtRE.MatchString(s):
+		return "value looks like a JWT"
+	case (strings.Contains(s, "AKIA") || strings.Contains(s, "ASIA")) && awsRE.MatchString(s):
+		return "value looks like an AWS access key"
+	}
+	return ""
+}
+
+// heuristicKey writes a marker instead of the value stored under the
+// map key and returns true if the key looks like it is used for
+// secrets.
+func (e *encoder) heuristicKey(key string) bool {
+	if e.heuristics == nil {
+		return false
+	}
+	if reason := e.heuristics.key(key); reason != "" {
+		e.string("***stripped: " + reason + "***")
+		return true
+	}
+	return false
+}
+
+// heuristicValue writes a marker instead of the string and returns
+// true if the string looks like a secret.
+func (e *encoder) heuristicValue(s string) bool {
+	if e.heuristics == nil {
+		return false
+	}
+	if reason := e.heuristics.value(s); reason != "" {
+		e.string("***stripped: " + reason + "***")
+		return true
+	}
+	return false
+}
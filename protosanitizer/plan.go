@@ -0,0 +1,238 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/descriptor"
+	"github.com/golang/protobuf/proto"
+	protobuf "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	descriptorMessageType = reflect.TypeOf((*descriptor.Message)(nil)).Elem()
+	protoMessageType      = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	jsonMarshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringType            = reflect.TypeOf("")
+)
+
+// noDescriptor returns an error if msg is a golang/protobuf message
+// without descriptor. Its fields cannot be inspected, so it must not
+// be serialized in strict mode.
+func noDescriptor(msg proto.Message) error {
+	if _, ok := msg.(descriptor.Message); ok {
+		return nil
+	}
+	return fmt.Errorf("no descriptor for %T", msg)
+}
+
+// fieldKind determines how the value of a field gets serialized.
+type fieldKind int
+
+const (
+	// plainField contains no secrets and is serialized
+	// like encoding/json would do it.
+	plainField fieldKind = iota
+	// secretField gets replaced with ***stripped*** when set.
+	secretField
+	// messageField contains a message, a slice of messages
+	// or a map with messages as values. All of those need
+	// to be stripped recursively.
+	messageField
+	// oneofField is the interface field which holds the
+	// wrapper struct of the alternative that is set.
+	oneofField
+	// unknownField cannot be inspected and therefore gets
+	// redacted in strict mode.
+	unknownField
+	// keyedField is a map where some entries get redacted
+	// because of the path policy.
+	keyedField
+)
+
+// messagePlan describes how to serialize a generated message struct.
+type messagePlan struct {
+	// fields are sorted by their JSON key, the same way as
+	// encoding/json sorts the keys of a map.
+	fields []fieldPlan
+
+	// wellKnown is true for the well-known types which get
+	// serialized by encoder.wellKnown instead.
+	wellKnown bool
+}
+
+// fieldPlan describes how to serialize one field of a struct.
+type fieldPlan struct {
+	index     int
+	name      string
+	omitEmpty bool
+	kind      fieldKind
+
+	// encode is used for plainField and, outside of strict mode,
+	// for unknownField. For keyedField, it serializes a single
+	// map value.
+	encode encoderFunc
+
+	// keys selects the map entries of a keyedField which get redacted.
+	keys *keyPolicy
+
+	// err explains why an unknownField cannot be inspected.
+	err error
+
+	// oneofs maps from the pointer type of the wrapper structs
+	// to the plan for the single field inside them.
+	oneofs map[reflect.Type]*fieldPlan
+}
+
+// plan returns the plan for the message struct t, creating it if needed.
+// t must be a struct whose pointer implements descriptor.Message.
+func (r *secretRules) plan(t reflect.Type) *messagePlan {
+	if plan, ok := r.plans.Load(t); ok {
+		return plan.(*messagePlan)
+	}
+	plan, _ := r.plans.LoadOrStore(t, r.newPlan(t))
+	return plan.(*messagePlan)
+}
+
+func (r *secretRules) newPlan(t reflect.Type) *messagePlan {
+	msg := reflect.New(t).Interface().(descriptor.Message)
+	fd, md := descriptor.ForMessage(msg)
+	info := newMessageInfo(proto.MessageName(msg), fd.GetPackage())
+	fields := map[string]*protobuf.FieldDescriptorProto{}
+	for _, field := range md.GetField() {
+		fields[field.GetName()] = field
+	}
+	props := proto.GetProperties(t)
+
+	// This relies on protobuf adding "json:" tags on each field where
+	// the name matches the field name in the protobuf spec (like
+	// volume_capabilities). The field.GetJsonName() method returns a
+	// different name (volumeCapabilities) which we don't use.
+	plan := &messagePlan{wellKnown: isWellKnown(protoreflect.FullName(proto.MessageName(msg)))}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, omitEmpty, ok := jsonKey(sf)
+		if !ok {
+			continue
+		}
+		var field fieldPlan
+		if sf.Tag.Get("protobuf_oneof") != "" {
+			// golang/protobuf stores the alternatives inside a
+			// wrapper struct (like VolumeCapability_Mount) which
+			// is assigned to an interface field of the message
+			// (like AccessType), so the JSON looks like
+			// {"AccessType":{"Mount":{...}}}.
+			field.kind = oneofField
+			field.oneofs = map[reflect.Type]*fieldPlan{}
+			for origName, oneof := range props.OneofTypes {
+				if oneof.Field != i {
+					continue
+				}
+				wrapped := oneof.Type.Elem().Field(0)
+				alternative := r.classify(fields[origName], origName, wrapped.Type, info)
+				alternative.name = wrapped.Name
+				field.oneofs[oneof.Type] = &alternative
+			}
+		} else {
+			origName := props.Prop[i].OrigName
+			field = r.classify(fields[origName], origName, sf.Type, info)
+		}
+		field.index, field.name, field.omitEmpty = i, name, omitEmpty
+		plan.fields = append(plan.fields, field)
+	}
+	sort.Slice(plan.fields, func(i, j int) bool {
+		return plan.fields[i].name < plan.fields[j].name
+	})
+	return plan
+}
+
+// classify determines how to handle a field of the message with the
+// given descriptor (nil if not found) and Go type.
+func (r *secretRules) classify(field *protobuf.FieldDescriptorProto, origName string, t reflect.Type, msg messageInfo) fieldPlan {
+	if field == nil {
+		return fieldPlan{kind: unknownField, encode: plainEncoder(t), err: fmt.Errorf("unknown field %s", origName)}
+	}
+	if r.isSecret(msg, field) {
+		return fieldPlan{kind: secretField}
+	}
+	secret, keys := r.paths.field(msg, field.GetName(), t.Kind() == reflect.Map)
+	if secret {
+		return fieldPlan{kind: secretField}
+	}
+	if keys != nil {
+		switch elem := t.Elem(); {
+		case elem.Kind() == reflect.Ptr && elem.Elem().Kind() == reflect.Struct && elem.Implements(descriptorMessageType):
+			return fieldPlan{kind: keyedField, keys: keys, encode: (*encoder).message}
+		case elem.Kind() != reflect.Ptr && elem.Kind() != reflect.Interface:
+			return fieldPlan{kind: keyedField, keys: keys, encode: plainEncoder(elem)}
+		}
+	}
+	if field.GetType() != protobuf.FieldDescriptorProto_TYPE_MESSAGE {
+		return fieldPlan{kind: plainField, encode: plainEncoder(t)}
+	}
+
+	// Repeated fields and maps contain messages as elements.
+	elem := t
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		elem = t.Elem()
+	}
+	var err error
+	switch {
+	case elem.Kind() == reflect.Ptr && elem.Elem().Kind() == reflect.Struct && elem.Implements(descriptorMessageType):
+		return fieldPlan{kind: messageField}
+	case t.Kind() == reflect.Map && elem.Kind() != reflect.Ptr && elem.Kind() != reflect.Interface:
+		// A map with scalar values, like map<string, string>.
+		return fieldPlan{kind: plainField, encode: plainEncoder(t)}
+	case elem.Implements(protoMessageType):
+		err = fmt.Errorf("no descriptor for %s", elem)
+	default:
+		err = fmt.Errorf("unknown message type %s", strings.TrimPrefix(field.GetTypeName(), "."))
+	}
+	return fieldPlan{kind: unknownField, encode: plainEncoder(t), err: err}
+}
+
+// jsonKey returns the key used by encoding/json for a struct field
+// and whether the field is included at all.
+func jsonKey(sf reflect.StructField) (name string, omitEmpty bool, ok bool) {
+	if sf.PkgPath != "" {
+		// Not exported.
+		return "", false, false
+	}
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = sf.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, true
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// pathPolicy redacts fields and map entries based on field paths, in
+// addition to the secret predicate. The syntax of the paths is
+// explained in WithRedactedPaths.
+type pathPolicy struct {
+	redact []string
+	allow  []string
+}
+
+// keyPolicy decides which entries of a map field get redacted.
+type keyPolicy struct {
+	redact []string
+	allow  []string
+}
+
+// secret returns true if the value stored under the key must be redacted.
+func (k *keyPolicy) secret(key string) bool {
+	return matchAny(k.redact, key) && !matchAny(k.allow, key)
+}
+
+// field determines how the policy applies to the field of a message.
+// The entire field is redacted if secret is true. Otherwise individual
+// entries get redacted if keys is non-nil, which is only possible for
+// map fields.
+func (p *pathPolicy) field(msg messageInfo, field string, isMap bool) (secret bool, keys *keyPolicy) {
+	if len(p.redact) == 0 {
+		return false, nil
+	}
+	redact, redactKeys := matchPaths(p.redact, msg.names, field)
+	allow, allowKeys := matchPaths(p.allow, msg.names, field)
+	if allow {
+		return false, nil
+	}
+	if redact {
+		return true, nil
+	}
+	if isMap && len(redactKeys) > 0 {
+		return false, &keyPolicy{redact: redactKeys, allow: allowKeys}
+	}
+	return false, nil
+}
+
+// matchPaths checks all paths against a field. It returns true if
+// at least one path refers to the entire field and the patterns for
+// the map keys of all paths which refer to entries of the field.
+func matchPaths(paths []string, messages []string, field string) (matched bool, keys []string) {
+	for _, path := range paths {
+		// The message name may contain dots, so each dot
+		// is a potential end of the message part.
+		for i := 0; i < len(path); i++ {
+			if path[i] != '.' {
+				continue
+			}
+			message, rest := path[:i], path[i+1:]
+			fieldPattern, key := rest, ""
+			j := strings.IndexByte(rest, '.')
+			if j >= 0 {
+				fieldPattern, key = rest[:j], rest[j+1:]
+			}
+			if !match(fieldPattern, field) || !matchMessage(message, messages) {
+				continue
+			}
+			if j >= 0 {
+				keys = append(keys, key)
+			} else {
+				matched = true
+			}
+		}
+	}
+	return matched, keys
+}
+
+// matchMessage returns true if one of the names of a message
+// matches the pattern.
+func matchMessage(pattern string, names []string) bool {
+	for _, name := range names {
+		if match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny returns true if the string matches one of the patterns.
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// match implements glob matching where * matches any sequence of
+// characters, including dots and slashes, and ? matches a single byte.
+func match(pattern, s string) bool {
+	// Iterative matching with backtracking to the most recent *.
+	p, i := 0, 0
+	star, next := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			p = star + 1
+			next++
+			i = next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// keyedMap serializes a map field of a Go struct where some entries
+// have to be redacted. elem serializes the other values.
+func (e *encoder) keyedMap(keys *keyPolicy, elem encoderFunc, v reflect.Value) {
+	if v.IsNil() {
+		e.buf.WriteString("null")
+		return
+	}
+	sorted := sortedKeys(v)
+	n := e.entries(len(sorted))
+	e.buf.WriteByte('{')
+	for i, key := range sorted[:n] {
+		if e.stop() {
+			break
+		}
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.string(key.name)
+		e.buf.WriteByte(':')
+		switch {
+		case keys.secret(key.name):
+			e.secretValue(v.MapIndex(key.value))
+		case !e.heuristicKey(key.name):
+			elem(e, v.MapIndex(key.value))
+		}
+	}
+	e.moreEntries(len(sorted)-n, true)
+	e.buf.WriteByte('}')
+}
+
+// reflectMap serializes a map field of an APIv2 message, redacting
+// the entries selected by keys (may be nil). value serializes
+// the other values.
+func (e *encoder) reflectMap(field protoreflect.FieldDescriptor, m protoreflect.Map, keys *keyPolicy, value func(protoreflect.FieldDescriptor, protoreflect.Value)) {
+	sorted := e.mapKeys(field, m)
+	n := e.entries(len(sorted))
+	e.buf.WriteByte('{')
+	for i, key := range sorted[:n] {
+		if e.stop() {
+			break
+		}
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.string(key.String())
+		e.buf.WriteByte(':')
+		switch {
+		case keys != nil && keys.secret(key.String()):
+			e.reflectSecretValue(field.MapValue(), m.Get(key))
+		case !e.heuristicKey(key.String()):
+			value(field.MapValue(), m.Get(key))
+		}
+	}
+	e.moreEntries(len(sorted)-n, true)
+	e.buf.WriteByte('}')
+}
@@ -0,0 +1,340 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// protoJSONPlan lists the fields of a message in the order in which
+// they get serialized in canonical proto3 JSON.
+type protoJSONPlan struct {
+	// entries are in declaration order. The key is the JSON name
+	// (lowerCamelCase unless overridden with json_name) and the
+	// fields of oneofs are included like all other fields.
+	entries []reflectEntry
+}
+
+// protoJSONPlan returns the plan for the message descriptor, creating it if needed.
+func (r *secretRules) protoJSONPlan(md protoreflect.MessageDescriptor) *protoJSONPlan {
+	if plan, ok := r.protoJSONPlans.Load(md); ok {
+		return plan.(*protoJSONPlan)
+	}
+	plan := &protoJSONPlan{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		plan.entries = append(plan.entries, r.reflectEntry(field.JSONName(), field))
+	}
+	actual, _ := r.protoJSONPlans.LoadOrStore(md, plan)
+	return actual.(*protoJSONPlan)
+}
+
+// protoJSONValue serializes an arbitrary value passed to StripSecrets
+// as canonical proto3 JSON.
+func (e *encoder) protoJSONValue(v reflect.Value) {
+	if !v.IsValid() {
+		e.buf.WriteString("null")
+		return
+	}
+	switch msg := v.Interface().(type) {
+	case protov2.Message:
+		e.protoJSONMessage(msg.ProtoReflect())
+	case proto.Message:
+		if err := noDescriptor(msg); err != nil && e.strict {
+			e.stripped(err)
+			return
+		}
+		// Go structs generated for golang/protobuf APIv1 get
+		// wrapped so that they can be walked like APIv2 messages.
+		e.protoJSONMessage(protoimpl.X.MessageOf(msg))
+	default:
+		e.marshal(v)
+	}
+}
+
+func (e *encoder) protoJSONMessage(m protoreflect.Message) {
+	if m == nil || !m.IsValid() {
+		e.buf.WriteString("null")
+		return
+	}
+	if !e.enter() {
+		return
+	}
+	if e.protoJSONWellKnown(m) {
+		e.depth--
+		return
+	}
+	e.buf.WriteByte('{')
+	e.protoJSONFields(m, true)
+	e.buf.WriteByte('}')
+	e.depth--
+}
+
+// protoJSONFields serializes the fields of a message without the
+// surrounding braces. first is false if there already is a field
+// before them.
+func (e *encoder) protoJSONFields(m protoreflect.Message, first bool) {
+	plan := e.rules.protoJSONPlan(m.Descriptor())
+	for i := range plan.entries {
+		if e.stop() {
+			break
+		}
+		entry := &plan.entries[i]
+		if !m.Has(entry.field) {
+			continue
+		}
+		if !first {
+			e.buf.WriteByte(',')
+		}
+		first = false
+		e.string(entry.key)
+		e.buf.WriteByte(':')
+		e.protoJSONField(entry, m.Get(entry.field))
+	}
+}
+
+func (e *encoder) protoJSONField(entry *reflectEntry, v protoreflect.Value) {
+	field := entry.field
+	switch {
+	case entry.secret:
+		e.reflectSecret(field, v)
+	case entry.err != nil && e.strict:
+		e.stripped(entry.err)
+	case field.IsList():
+		list := v.List()
+		e.buf.WriteByte('[')
+		n := e.entries(list.Len())
+		for i := 0; i < n; i++ {
+			if e.stop() {
+				break
+			}
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.protoJSONScalar(field, list.Get(i))
+		}
+		e.moreEntries(list.Len()-n, false)
+		e.buf.WriteByte(']')
+	case field.IsMap():
+		e.reflectMap(field, v.Map(), entry.keys, e.protoJSONScalar)
+	default:
+		e.protoJSONScalar(field, v)
+	}
+}
+
+// protoJSONScalar serializes a single value of the given field.
+func (e *encoder) protoJSONScalar(field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		e.protoJSONMessage(v.Message())
+	case protoreflect.BoolKind:
+		e.buf.Write(strconv.AppendBool(e.scratch[:0], v.Bool()))
+	case protoreflect.EnumKind:
+		if field.Enum().FullName() == "google.protobuf.NullValue" {
+			e.buf.WriteString("null")
+			return
+		}
+		if value := field.Enum().Values().ByNumber(v.Enum()); value != nil {
+			e.string(string(value.Name()))
+			return
+		}
+		e.buf.Write(strconv.AppendInt(e.scratch[:0], int64(v.Enum()), 10))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		e.buf.Write(strconv.AppendInt(e.scratch[:0], v.Int(), 10))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		e.buf.Write(strconv.AppendUint(e.scratch[:0], v.Uint(), 10))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// 64 bit integers are strings because they cannot
+		// be represented exactly by JSON numbers.
+		e.buf.WriteByte('"')
+		e.buf.Write(strconv.AppendInt(e.scratch[:0], v.Int(), 10))
+		e.buf.WriteByte('"')
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		e.buf.WriteByte('"')
+		e.buf.Write(strconv.AppendUint(e.scratch[:0], v.Uint(), 10))
+		e.buf.WriteByte('"')
+	case protoreflect.FloatKind:
+		e.protoJSONFloat(v.Float(), 32)
+	case protoreflect.DoubleKind:
+		e.protoJSONFloat(v.Float(), 64)
+	case protoreflect.StringKind:
+		e.stringValue(v.String())
+	case protoreflect.BytesKind:
+		e.bytesValue(v.Bytes())
+	default:
+		e.buf.WriteString("null")
+	}
+}
+
+func (e *encoder) protoJSONFloat(f float64, bitSize int) {
+	switch {
+	case math.IsNaN(f):
+		e.buf.WriteString(`"NaN"`)
+	case math.IsInf(f, 1):
+		e.buf.WriteString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		e.buf.WriteString(`"-Infinity"`)
+	case bitSize == 32:
+		e.marshal(reflect.ValueOf(float32(f)))
+	default:
+		e.marshal(reflect.ValueOf(f))
+	}
+}
+
+// protoJSONWellKnown handles the well-known types which have a special
+// representation in proto3 JSON. It returns false for all other messages.
+func (e *encoder) protoJSONWellKnown(m protoreflect.Message) bool {
+	md := m.Descriptor()
+	if md.ParentFile() == nil || md.ParentFile().Package() != "google.protobuf" {
+		return false
+	}
+	fields := md.Fields()
+	switch md.Name() {
+	case "Timestamp", "Duration":
+		e.string(timeText(m, false))
+	case "DoubleValue", "FloatValue", "Int64Value", "UInt64Value",
+		"Int32Value", "UInt32Value", "BoolValue", "StringValue", "BytesValue":
+		value := fields.ByName("value")
+		e.protoJSONScalar(value, m.Get(value))
+	case "Any":
+		e.protoJSONAny(m)
+	case "Empty":
+		e.buf.WriteString("{}")
+	case "FieldMask":
+		paths := m.Get(fields.ByName("paths")).List()
+		camel := make([]string, 0, paths.Len())
+		for i := 0; i < paths.Len(); i++ {
+			camel = append(camel, lowerCamelCase(paths.Get(i).String()))
+		}
+		e.string(strings.Join(camel, ","))
+	case "Struct":
+		e.protoJSONField(&reflectEntry{field: fields.ByName("fields")}, m.Get(fields.ByName("fields")))
+	case "ListValue":
+		e.protoJSONField(&reflectEntry{field: fields.ByName("values")}, m.Get(fields.ByName("values")))
+	case "Value":
+		field := m.WhichOneof(md.Oneofs().ByName("kind"))
+		if field == nil {
+			e.buf.WriteString("null")
+			return true
+		}
+		e.protoJSONScalar(field, m.Get(field))
+	default:
+		return false
+	}
+	return true
+}
+
+// formatTimestamp formats seconds and nanoseconds since the epoch as
+// RFC 3339 in UTC, with 0, 3, 6 or 9 fractional digits.
+func formatTimestamp(seconds int64, nanos int32) string {
+	t := time.Unix(seconds, int64(nanos)).UTC()
+	s := t.Format("2006-01-02T15:04:05.000000000")
+	return trimFraction(s) + "Z"
+}
+
+// formatDuration formats a duration like 1.5s, with 0, 3, 6 or 9
+// fractional digits.
+func formatDuration(seconds int64, nanos int32) string {
+	sign := ""
+	if seconds < 0 || nanos < 0 {
+		sign = "-"
+		if seconds < 0 {
+			seconds = -seconds
+		}
+		if nanos < 0 {
+			nanos = -nanos
+		}
+	}
+	s := strconv.FormatInt(seconds, 10) + "." + strconv.FormatInt(int64(nanos)+1000000000, 10)[1:]
+	return sign + trimFraction(s) + "s"
+}
+
+// trimFraction removes trailing groups of three zeros
+// from the nine fractional digits at the end of s.
+func trimFraction(s string) string {
+	s = strings.TrimSuffix(s, "000")
+	s = strings.TrimSuffix(s, "000")
+	return strings.TrimSuffix(s, ".000")
+}
+
+// lowerCamelCase converts a field name like volume_id into volumeId.
+func lowerCamelCase(s string) string {
+	var b strings.Builder
+	upper := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_':
+			upper = true
+		case upper && isASCIILower(c):
+			b.WriteByte(c ^ ' ')
+			upper = false
+		default:
+			b.WriteByte(c)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+// mapKeys returns the keys of a map in the order in which they get
+// serialized. proto3 JSON and the other formats sort numerically for
+// integers and lexically for everything else. The JSON for APIv1 Go
+// structs is always sorted lexically.
+func (e *encoder) mapKeys(field protoreflect.FieldDescriptor, m protoreflect.Map) []protoreflect.MapKey {
+	return sortedMapKeys(field, m, e.format == FormatJSON)
+}
+
+// sortedMapKeys returns the keys of a map, sorted lexically if
+// lexical is true, otherwise numerically for integers.
+func sortedMapKeys(field protoreflect.FieldDescriptor, m protoreflect.Map, lexical bool) []protoreflect.MapKey {
+	keys := make([]protoreflect.MapKey, 0, m.Len())
+	m.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	kind := field.MapKey().Kind()
+	if lexical {
+		kind = protoreflect.StringKind
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		switch kind {
+		case protoreflect.BoolKind:
+			return !keys[i].Bool() && keys[j].Bool()
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+			protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+			return keys[i].Int() < keys[j].Int()
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+			protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			return keys[i].Uint() < keys[j].Uint()
+		default:
+			return keys[i].String() < keys[j].String()
+		}
+	})
+	return keys
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	protobuf "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// reflectPlan describes how to serialize messages with a certain
+// protoreflect.MessageDescriptor. The output is the same as for the
+// Go structs generated by golang/protobuf APIv1, so the result does
+// not depend on which API the CSI Go bindings were generated for.
+type reflectPlan struct {
+	// entries are sorted by their JSON key.
+	entries []reflectEntry
+}
+
+// reflectEntry describes one field or oneof of a message.
+type reflectEntry struct {
+	key    string
+	field  protoreflect.FieldDescriptor
+	secret bool
+
+	// keys is set for maps where some entries get redacted
+	// because of the path policy.
+	keys *keyPolicy
+
+	// err explains why a field cannot be inspected.
+	err error
+
+	// oneof is set instead of field for a oneof. The key of the
+	// entry then is the Go name of the interface field and
+	// alternatives contains the entries for the fields in
+	// the oneof, using their Go names as keys.
+	oneof        protoreflect.OneofDescriptor
+	alternatives map[protoreflect.FieldNumber]*reflectEntry
+}
+
+// reflectPlan returns the plan for the message descriptor, creating it if needed.
+func (r *secretRules) reflectPlan(md protoreflect.MessageDescriptor) *reflectPlan {
+	if plan, ok := r.reflectPlans.Load(md); ok {
+		return plan.(*reflectPlan)
+	}
+	plan, _ := r.reflectPlans.LoadOrStore(md, r.newReflectPlan(md))
+	return plan.(*reflectPlan)
+}
+
+func (r *secretRules) newReflectPlan(md protoreflect.MessageDescriptor) *reflectPlan {
+	plan := &reflectPlan{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			continue
+		}
+		plan.entries = append(plan.entries, r.reflectEntry(string(field.Name()), field))
+	}
+	oneofs := md.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() {
+			continue
+		}
+		entry := reflectEntry{
+			key:          camelCase(string(oneof.Name())),
+			oneof:        oneof,
+			alternatives: map[protoreflect.FieldNumber]*reflectEntry{},
+		}
+		fields := oneof.Fields()
+		for e := 0; e < fields.Len(); e++ {
+			field := fields.Get(e)
+			alternative := r.reflectEntry(camelCase(string(field.Name())), field)
+			entry.alternatives[field.Number()] = &alternative
+		}
+		plan.entries = append(plan.entries, entry)
+	}
+	sort.Slice(plan.entries, func(i, j int) bool {
+		return plan.entries[i].key < plan.entries[j].key
+	})
+	return plan
+}
+
+func (r *secretRules) reflectEntry(key string, field protoreflect.FieldDescriptor) reflectEntry {
+	entry := reflectEntry{key: key, field: field}
+	// The secret predicates work with APIv1 descriptors. Converting
+	// via the wire format preserves the field options, including
+	// extensions like csi_secret which are unknown to APIv2.
+	fd := &protobuf.FieldDescriptorProto{}
+	data, err := protov2.Marshal(protodesc.ToFieldDescriptorProto(field))
+	if err == nil {
+		err = proto.Unmarshal(data, fd)
+	}
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+	md := field.ContainingMessage()
+	pkg := ""
+	if md.ParentFile() != nil {
+		pkg = string(md.ParentFile().Package())
+	}
+	msg := newMessageInfo(string(md.FullName()), pkg)
+	entry.secret = r.isSecret(msg, fd)
+	if !entry.secret {
+		entry.secret, entry.keys = r.paths.field(msg, string(field.Name()), field.IsMap())
+	}
+	entry.err = unknownMessage(field)
+	return entry
+}
+
+// unknownMessage returns an error if the values of the field are
+// messages whose type is not known and thus cannot be inspected.
+func unknownMessage(field protoreflect.FieldDescriptor) error {
+	if field.IsMap() {
+		field = field.MapValue()
+	}
+	if isMessage(field) && field.Message().IsPlaceholder() {
+		return fmt.Errorf("unknown message type %s", field.Message().FullName())
+	}
+	return nil
+}
+
+// reflectMessage serializes an APIv2 message.
+func (e *encoder) reflectMessage(m protoreflect.Message) {
+	if !m.IsValid() {
+		e.buf.WriteString("null")
+		return
+	}
+	if !e.enter() {
+		return
+	}
+	if e.wellKnown(m) {
+		e.depth--
+		return
+	}
+	plan := e.rules.reflectPlan(m.Descriptor())
+	e.buf.WriteByte('{')
+	first := true
+	for i := range plan.entries {
+		if e.stop() {
+			break
+		}
+		entry := &plan.entries[i]
+		if entry.oneof == nil && !m.Has(entry.field) {
+			continue
+		}
+		if !first {
+			e.buf.WriteByte(',')
+		}
+		first = false
+		e.string(entry.key)
+		e.buf.WriteByte(':')
+		if entry.oneof == nil {
+			e.reflectField(entry, m.Get(entry.field))
+			continue
+		}
+
+		// Like a nil interface field in an APIv1 struct,
+		// an unset oneof is null.
+		field := m.WhichOneof(entry.oneof)
+		if field == nil {
+			e.buf.WriteString("null")
+			continue
+		}
+		alternative := entry.alternatives[field.Number()]
+		e.buf.WriteByte('{')
+		e.string(alternative.key)
+		e.buf.WriteByte(':')
+		e.reflectField(alternative, m.Get(field))
+		e.buf.WriteByte('}')
+	}
+	e.buf.WriteByte('}')
+	e.depth--
+}
+
+func (e *encoder) reflectField(entry *reflectEntry, v protoreflect.Value) {
+	field := entry.field
+	switch {
+	case entry.secret:
+		e.reflectSecret(field, v)
+	case entry.err != nil && e.strict:
+		e.stripped(entry.err)
+	case field.IsList():
+		list := v.List()
+		e.buf.WriteByte('[')
+		n := e.entries(list.Len())
+		for i := 0; i < n; i++ {
+			if e.stop() {
+				break
+			}
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.reflectValue(field, list.Get(i))
+		}
+		e.moreEntries(list.Len()-n, false)
+		e.buf.WriteByte(']')
+	case field.IsMap():
+		e.reflectMap(field, v.Map(), entry.keys, e.reflectValue)
+	default:
+		e.reflectValue(field, v)
+	}
+}
+
+// reflectValue serializes a single value the same way as
+// encoding/json does for the corresponding APIv1 Go type.
+func (e *encoder) reflectValue(field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		e.reflectMessage(v.Message())
+	case protoreflect.BoolKind:
+		e.buf.Write(strconv.AppendBool(e.scratch[:0], v.Bool()))
+	case protoreflect.EnumKind:
+		e.buf.Write(strconv.AppendInt(e.scratch[:0], int64(v.Enum()), 10))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		e.buf.Write(strconv.AppendInt(e.scratch[:0], v.Int(), 10))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		e.buf.Write(strconv.AppendUint(e.scratch[:0], v.Uint(), 10))
+	case protoreflect.FloatKind:
+		e.marshal(reflect.ValueOf(float32(v.Float())))
+	case protoreflect.DoubleKind:
+		e.marshal(reflect.ValueOf(v.Float()))
+	case protoreflect.StringKind:
+		e.stringValue(v.String())
+	case protoreflect.BytesKind:
+		e.bytesValue(v.Bytes())
+	default:
+		e.buf.WriteString("null")
+	}
+}
+
+// camelCase converts a name like access_type into the name of the
+// corresponding Go field (AccessType), using the same rules as
+// protoc-gen-go.
+func camelCase(s string) string {
+	if s == "" {
+		return ""
+	}
+	t := make([]byte, 0, 32)
+	i := 0
+	if s[0] == '_' {
+		// Need a capital letter; drop the '_'.
+		t = append(t, 'X')
+		i++
+	}
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '_' && i+1 < len(s) && isASCIILower(s[i+1]) {
+			continue
+		}
+		if isASCIIDigit(c) {
+			t = append(t, c)
+			continue
+		}
+		if isASCIILower(c) {
+			c ^= ' '
+		}
+		t = append(t, c)
+		for i+1 < len(s) && isASCIILower(s[i+1]) {
+			i++
+			t = append(t, s[i])
+		}
+	}
+	return string(t)
+}
+
+func isASCIILower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func isASCIIDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
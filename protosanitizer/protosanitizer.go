@@ -16,18 +16,24 @@ limitations under the License.
 
 // Package protosanitizer supports logging of gRPC messages without
 // accidentally revealing sensitive fields.
+//
+// The stripsecrets analyzer in the sub-package of the same name finds
+// logging calls which pass such messages without StripSecrets. It can
+// be run with "go vet -vettool".
 package protosanitizer
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
+	"sync"
 
-	"github.com/golang/protobuf/descriptor"
 	"github.com/golang/protobuf/proto"
 	protobuf "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	protobufdescriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 // StripSecrets returns a wrapper around the original CSI gRPC message
@@ -36,121 +42,282 @@ import (
 // Instead of the secret value(s), the string "***stripped***" is
 // included in the result.
 //
-// StripSecrets relies on an extension in CSI 1.0 and thus can only
-// be used for messages based on that or a more recent spec!
+// Which fields contain secrets is determined based on the proto
+// package of each message: for csi.v1, the csi_secret field option
+// is used, for csi.v0 (CSI 0.3 and older) the _secrets suffix of the
+// field name. For all other packages, a field is treated as secret
+// if either of those rules applies. Additional field options can be
+// added with RegisterSecretExtension.
+//
+// Messages embedded in a google.protobuf.Any are looked up by their
+// type URL in the protobuf type registries (see also WithMessageTypes)
+// and sanitized like all other messages. The result has the type URL
+// under "@type" and the message under "value". If the type is not
+// known, the entire value is replaced.
+//
+// Timestamps are serialized as RFC 3339 strings, durations like
+// "1.5s" and wrapper types like google.protobuf.BoolValue as the
+// value inside them. All trailing zeros of the fractional seconds
+// get removed. Only FormatProtoJSON keeps the canonical proto3 JSON
+// form with 3, 6 or 9 fractional digits, for example "1.500s".
+//
+// Messages generated for golang/protobuf (APIv1) and for
+// google.golang.org/protobuf (APIv2) are both supported and
+// result in the same output. So are dynamic messages, for example
+// those decoded with a DescriptorSet loaded at runtime.
 //
 // StripSecrets itself is fast and therefore it is cheap to pass the
 // result to logging functions which may or may not end up serializing
 // the parameter depending on the current log level.
+//
+// The result also implements io.WriterTo and fmt.Formatter. Both
+// write the serialized message directly into the destination, for
+// example the buffer of a logger which formats its parameters with
+// %s or %v, without allocating a string for it. For structured
+// logging, it implements slog.LogValuer and logr.Marshaler, which
+// turn the sanitized fields into nested attributes.
 func StripSecrets(msg interface{}) fmt.Stringer {
-	return &stripSecrets{msg, isCSI1Secret}
+	return defaultSanitizer.StripSecrets(msg)
 }
 
-// StripSecretsCSI03 is like StripSecrets, except that it works
-// for messages based on CSI 0.3 and older. It does not work
-// for CSI 1.0, use StripSecrets for that.
+// StripSecretsCSI03 is like StripSecrets, except that it always
+// uses the naming convention from CSI 0.3 and older. It does not work
+// for CSI 1.0. StripSecrets handles both and therefore is preferred.
 func StripSecretsCSI03(msg interface{}) fmt.Stringer {
-	return &stripSecrets{msg, isCSI03Secret}
+	return csi03Sanitizer.StripSecrets(msg)
 }
 
-type stripSecrets struct {
-	msg interface{}
+// StripSecretsStrict is like StripSecrets, except that it fails
+// closed: fields which might contain secrets but cannot be inspected,
+// for example because the type of a nested message is not known,
+// are replaced with a "***stripped: <reason>***" marker instead of
+// being included as they are. With WithStrict, the same applies to
+// all output formats and to structured logging.
+func StripSecretsStrict(msg interface{}) fmt.Stringer {
+	return strictSanitizer.StripSecrets(msg)
+}
 
-	isSecretField func(field *protobuf.FieldDescriptorProto) bool
+// StripSecretsProtoJSON is like StripSecrets, except that the message
+// is serialized as canonical proto3 JSON: field names are
+// lowerCamelCase, enums are represented by their name, the fields
+// of a oneof are stored directly in the message, 64 bit integers are
+// strings and well-known types like google.protobuf.Timestamp have
+// their special representation. The result can be parsed by standard
+// protobuf JSON tooling, for example protojson.Unmarshal, as long as
+// no field is stripped. Stripped fields contain "***stripped***"
+// regardless of their type.
+func StripSecretsProtoJSON(msg interface{}) fmt.Stringer {
+	return protoJSONSanitizer.StripSecrets(msg)
+}
+
+// StripSecretsRedacted is like StripSecrets, except that the redactor
+// determines what gets logged instead of the secret values. For
+// example, HMACFingerprint makes it possible to tell whether two calls
+// used the same credentials. Depending on the redactor, secret maps
+// get logged as maps with the keys and redacted values instead of
+// a single string.
+func StripSecretsRedacted(msg interface{}, redactor Redactor) fmt.Stringer {
+	return New(WithRedactor(redactor)).StripSecrets(msg)
+}
+
+var (
+	defaultSanitizer   = New()
+	csi03Sanitizer     = New(WithSecretPredicate(IsCSI03Secret))
+	strictSanitizer    = New(WithStrict())
+	protoJSONSanitizer = New(WithFormat(FormatProtoJSON))
+)
+
+type stripSecrets struct {
+	msg       interface{}
+	sanitizer *Sanitizer
 }
 
 func (s *stripSecrets) String() string {
-	// First convert to a generic representation. That's less efficient
-	// than using reflect directly, but easier to work with.
-	var parsed interface{}
-	b, err := json.Marshal(s.msg)
-	if err != nil {
-		return fmt.Sprintf("<<json.Marshal %T: %s>>", s.msg, err)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	s.encode(buf, nil)
+	return buf.String()
+}
+
+// WriteTo implements io.WriterTo. It writes the same output as String.
+// Large messages are passed on to w in chunks while walking them, so
+// the output does not have to be kept in memory as a whole. That is
+// not possible when the output has a maximum size (see WithMaxSize).
+func (s *stripSecrets) WriteTo(w io.Writer) (int64, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	return s.encode(buf, w)
+}
+
+// Format implements fmt.Formatter. %s and %v without width and
+// precision get written as they are, all other verbs and flags
+// are applied to the result of String.
+func (s *stripSecrets) Format(f fmt.State, verb rune) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	_, width := f.Width()
+	_, precision := f.Precision()
+	if (verb == 's' || (verb == 'v' && !f.Flag('#'))) && !width && !precision {
+		s.encode(buf, f)
+		return
+	}
+	s.encode(buf, nil)
+	fmt.Fprintf(f, fmt.FormatString(f, verb), buf.String())
+}
+
+// encode serializes the message. If w is nil, the result is left in
+// the buffer, otherwise it gets written to w.
+func (s *stripSecrets) encode(buf *bytes.Buffer, w io.Writer) (int64, error) {
+	// Serialize directly from the Go struct, using the cached
+	// plan for each message type to find the secret fields.
+	sanitizer := s.sanitizer
+	e := sanitizer.newEncoder(buf)
+	if sanitizer.maxSize == 0 {
+		// Truncating needs the entire output, so only stream
+		// without a maximum size.
+		e.w = w
 	}
-	if err := json.Unmarshal(b, &parsed); err != nil {
-		return fmt.Sprintf("<<json.Unmarshal %T: %s>>", s.msg, err)
+	switch sanitizer.format {
+	case FormatProtoJSON:
+		e.protoJSONValue(reflect.ValueOf(s.msg))
+	case FormatText, FormatLogfmt, FormatYAML:
+		e.tree = newTreeFormat(sanitizer.format)
+		e.treeValueOf(reflect.ValueOf(s.msg))
+	default:
+		e.value(reflect.ValueOf(s.msg))
 	}
+	switch {
+	case e.werr != nil:
+		return e.written, e.werr
+	case e.err != nil:
+		// Output which was already written to w cannot be
+		// taken back, the error follows after it.
+		buf.Reset()
+		fmt.Fprintf(buf, "<<json.Marshal %T: %s>>", s.msg, e.err)
+	default:
+		e.truncate()
+	}
+	if w == nil {
+		return 0, nil
+	}
+	n, err := buf.WriteTo(w)
+	return e.written + n, err
+}
 
-	// Now remove secrets from the generic representation of the message.
-	s.strip(parsed, s.msg)
+// newEncoder returns an encoder with the configuration of the sanitizer.
+func (s *Sanitizer) newEncoder(buf *bytes.Buffer) encoder {
+	return encoder{
+		buf:      buf,
+		rules:    s.rules,
+		strict:   s.strict,
+		format:   s.format,
+		redactor: s.redactor,
+		maxSize:  s.maxSize,
+		maxDepth: s.maxDepth,
 
-	// Re-encoded the stripped representation and return that.
-	b, err = json.Marshal(parsed)
-	if err != nil {
-		return fmt.Sprintf("<<json.Marshal %T: %s>>", s.msg, err)
+		maxEntries:      s.maxEntries,
+		maxStringLength: s.maxStringLength,
+		heuristics:      s.heuristics,
 	}
-	return string(b)
 }
 
-func (s *stripSecrets) strip(parsed interface{}, msg interface{}) {
-	protobufMsg, ok := msg.(descriptor.Message)
-	if !ok {
-		// Not a protobuf message, so we are done.
+// maxPooledBuffer is the capacity up to which buffers get reused.
+// Larger buffers are left to the garbage collector, so that logging
+// a single huge message does not keep its memory allocated.
+const maxPooledBuffer = 64 * 1024
+
+// flushSize is the amount of buffered output after which WriteTo
+// passes it on, which keeps the buffer below maxPooledBuffer unless
+// a single value is very large.
+const flushSize = 32 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
 		return
 	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
 
-	// The corresponding map in the parsed JSON representation.
-	parsedFields, ok := parsed.(map[string]interface{})
-	if !ok {
-		// Probably nil.
-		return
+// secretRules determines which fields contain secrets. The plans
+// derived from those rules are cached per message type, so the
+// descriptor of a message only has to be parsed once.
+type secretRules struct {
+	// isSecretField is nil when choosing the predicate based on
+	// the package of each message.
+	isSecretField func(field *protobuf.FieldDescriptorProto) bool
+
+	// paths redacts additional fields and map entries.
+	paths pathPolicy
+
+	// types, if set, is used first when unpacking google.protobuf.Any.
+	types protoregistry.MessageTypeResolver
+
+	// plans maps from the reflect.Type of a message struct
+	// to its *messagePlan.
+	plans sync.Map
+
+	// reflectPlans maps from the protoreflect.MessageDescriptor
+	// of an APIv2 message to its *reflectPlan.
+	reflectPlans sync.Map
+
+	// protoJSONPlans maps from the protoreflect.MessageDescriptor
+	// of a message to its *protoJSONPlan.
+	protoJSONPlans sync.Map
+}
+
+// defaultRules is shared by all sanitizers which use the default
+// secret predicate and no paths.
+var defaultRules = &secretRules{}
+
+// messageInfo describes the message which contains a field.
+type messageInfo struct {
+	// pkg is the proto package, like csi.v1.
+	pkg string
+
+	// names are the full name (csi.v1.CreateVolumeRequest) and the
+	// name without the package (CreateVolumeRequest,
+	// VolumeCapability.MountVolume), see WithRedactedPaths.
+	names []string
+}
+
+func newMessageInfo(fullName, pkg string) messageInfo {
+	if pkg == "" {
+		return messageInfo{names: []string{fullName}}
 	}
+	return messageInfo{pkg: pkg, names: []string{fullName, strings.TrimPrefix(fullName, pkg+".")}}
+}
 
-	// Walk through all fields and replace those with ***stripped*** that
-	// are marked as secret. This relies on protobuf adding "json:" tags
-	// on each field where the name matches the field name in the protobuf
-	// spec (like volume_capabilities). The field.GetJsonName() method returns
-	// a different name (volumeCapabilities) which we don't use.
-	_, md := descriptor.ForMessage(protobufMsg)
-	fields := md.GetField()
-	if fields != nil {
-		for _, field := range fields {
-			if s.isSecretField(field) {
-				// Overwrite only if already set.
-				if _, ok := parsedFields[field.GetName()]; ok {
-					parsedFields[field.GetName()] = "***stripped***"
-				}
-			} else if field.GetType() == protobuf.FieldDescriptorProto_TYPE_MESSAGE {
-				// When we get here,
-				// the type name is something like ".csi.v1.CapacityRange" (leading dot!)
-				// and looking up "csi.v1.CapacityRange"
-				// returns the type of a pointer to a pointer
-				// to CapacityRange. We need a pointer to such
-				// a value for recursive stripping.
-				typeName := field.GetTypeName()
-				if strings.HasPrefix(typeName, ".") {
-					typeName = typeName[1:]
-				}
-				t := proto.MessageType(typeName)
-				if t == nil || t.Kind() != reflect.Ptr {
-					// Shouldn't happen, but
-					// better check anyway instead
-					// of panicking.
-					continue
-				}
-				v := reflect.New(t.Elem())
-
-				// Recursively strip the message(s) that
-				// the field contains.
-				i := v.Interface()
-				entry := parsedFields[field.GetName()]
-				if slice, ok := entry.([]interface{}); ok {
-					// Array of values, like VolumeCapabilities in CreateVolumeRequest.
-					for _, entry := range slice {
-						s.strip(entry, i)
-					}
-				} else {
-					// Single value.
-					s.strip(entry, i)
-				}
-			}
-		}
+// isSecret determines whether a field of the message contains secrets.
+func (r *secretRules) isSecret(msg messageInfo, field *protobuf.FieldDescriptorProto) bool {
+	if r.isSecretField != nil {
+		return r.isSecretField(field)
+	}
+	switch msg.pkg {
+	case "csi.v0":
+		return IsCSI03Secret(field) || IsRegisteredSecret(field)
+	case "csi.v1":
+		return IsCSI1Secret(field) || IsRegisteredSecret(field)
+	default:
+		// Could be a future version of the spec or something
+		// that uses it, so better check for both.
+		return IsCSI1Secret(field) || IsCSI03Secret(field) || IsRegisteredSecret(field)
 	}
 }
 
-// isCSI1Secret uses the csi.E_CsiSecret extension from CSI 1.0 to
+// IsCSI1Secret uses the csi.E_CsiSecret extension from CSI 1.0 to
 // determine whether a field contains secrets.
-func isCSI1Secret(field *protobuf.FieldDescriptorProto) bool {
+func IsCSI1Secret(field *protobuf.FieldDescriptorProto) bool {
 	ex, err := proto.GetExtension(field.Options, e_CsiSecret)
 	return err == nil && ex != nil && *ex.(*bool)
 }
@@ -170,8 +337,50 @@ var e_CsiSecret = &proto.ExtensionDesc{
 	Filename:      "github.com/container-storage-interface/spec/csi.proto",
 }
 
-// isCSI03Secret relies on the naming convention in CSI <= 0.3
+// secretExtensions are the field options registered with
+// RegisterSecretExtension.
+var secretExtensions struct {
+	sync.RWMutex
+	descs []*proto.ExtensionDesc
+}
+
+// RegisterSecretExtension adds a boolean field option which marks
+// fields as secret, like csi.v1.csi_secret does for CSI. It gets
+// checked for messages of all packages unless a custom predicate is
+// set with WithSecretPredicate.
+//
+// Because the result is cached per message type, it must be called
+// before messages which use the option get serialized, typically in
+// an init function. It panics if the extension is not a boolean
+// extension of google.protobuf.FieldOptions.
+func RegisterSecretExtension(desc *proto.ExtensionDesc) {
+	if _, ok := desc.ExtendedType.(*protobufdescriptor.FieldOptions); !ok {
+		panic(fmt.Sprintf("protosanitizer: %s does not extend google.protobuf.FieldOptions", desc.Name))
+	}
+	if _, ok := desc.ExtensionType.(*bool); !ok {
+		panic(fmt.Sprintf("protosanitizer: %s is not a bool", desc.Name))
+	}
+	secretExtensions.Lock()
+	defer secretExtensions.Unlock()
+	secretExtensions.descs = append(secretExtensions.descs, desc)
+}
+
+// IsRegisteredSecret checks whether one of the extensions registered
+// with RegisterSecretExtension is set for the field.
+func IsRegisteredSecret(field *protobuf.FieldDescriptorProto) bool {
+	secretExtensions.RLock()
+	defer secretExtensions.RUnlock()
+	for _, desc := range secretExtensions.descs {
+		ex, err := proto.GetExtension(field.Options, desc)
+		if err == nil && ex != nil && *ex.(*bool) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCSI03Secret relies on the naming convention in CSI <= 0.3
 // to determine whether a field contains secrets.
-func isCSI03Secret(field *protobuf.FieldDescriptorProto) bool {
+func IsCSI03Secret(field *protobuf.FieldDescriptorProto) bool {
 	return strings.HasSuffix(field.GetName(), "_secrets")
 }
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package protozap logs gRPC messages with zap as nested objects
+// instead of strings, with secrets stripped by protosanitizer:
+//
+//	logger.Info("CreateVolume", zap.Object("request", protozap.Object(req)))
+package protozap
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Object returns a zapcore.ObjectMarshaler which adds the fields of
+// the message, stripped the same way as by protosanitizer.StripSecrets.
+// Values which are not messages are added as string under the key
+// "value".
+func Object(msg interface{}) zapcore.ObjectMarshaler {
+	return object{protosanitizer.StripSecrets(msg)}
+}
+
+// ObjectWith is like Object, except that the sanitizer determines
+// which fields are secret and which limits apply.
+func ObjectWith(s *protosanitizer.Sanitizer, msg interface{}) zapcore.ObjectMarshaler {
+	return object{s.StripSecrets(msg)}
+}
+
+type object struct {
+	stripped fmt.Stringer
+}
+
+func (o object) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	// The structured representation of the sanitized message is
+	// available through slog.LogValuer.
+	v := o.stripped.(slog.LogValuer).LogValue()
+	if v.Kind() != slog.KindGroup {
+		enc.AddString("value", v.String())
+		return nil
+	}
+	return group(v.Group()).MarshalLogObject(enc)
+}
+
+// group adds the fields of a nested message or map.
+type group []slog.Attr
+
+func (g group) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, attr := range g {
+		if err := addValue(enc, attr.Key, attr.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addValue(enc zapcore.ObjectEncoder, key string, v slog.Value) error {
+	switch v.Kind() {
+	case slog.KindGroup:
+		return enc.AddObject(key, group(v.Group()))
+	case slog.KindInt64:
+		enc.AddInt64(key, v.Int64())
+	case slog.KindUint64:
+		enc.AddUint64(key, v.Uint64())
+	case slog.KindFloat64:
+		enc.AddFloat64(key, v.Float64())
+	case slog.KindBool:
+		enc.AddBool(key, v.Bool())
+	case slog.KindString:
+		enc.AddString(key, v.String())
+	default:
+		if list, ok := v.Any().([]interface{}); ok {
+			return enc.AddArray(key, array(list))
+		}
+		return enc.AddReflected(key, v.Any())
+	}
+	return nil
+}
+
+// array adds the values of a repeated field. Messages inside it
+// are stored as maps.
+type array []interface{}
+
+func (a array) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, value := range a {
+		var err error
+		switch value := value.(type) {
+		case map[string]interface{}:
+			err = enc.AppendObject(fields(value))
+		case []interface{}:
+			err = enc.AppendArray(array(value))
+		case int64:
+			enc.AppendInt64(value)
+		case uint64:
+			enc.AppendUint64(value)
+		case float64:
+			enc.AppendFloat64(value)
+		case bool:
+			enc.AppendBool(value)
+		case string:
+			enc.AppendString(value)
+		default:
+			err = enc.AppendReflected(value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fields adds the entries of a map in sorted order.
+type fields map[string]interface{}
+
+func (f fields) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var err error
+		switch value := f[key].(type) {
+		case map[string]interface{}:
+			err = enc.AddObject(key, fields(value))
+		case []interface{}:
+			err = enc.AddArray(key, array(value))
+		default:
+			err = addValue(enc, key, slog.AnyValue(value))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
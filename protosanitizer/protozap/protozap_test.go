@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protozap
+
+import (
+	"testing"
+
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+	csi "github.com/kubernetes-csi/csi-lib-utils/protosanitizer/test/csi10"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestObject(t *testing.T) {
+	createVolume := &csi.CreateVolumeRequest{
+		Name: "test-volume",
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1024,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			&csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						FsType:     "ext4",
+						MountFlags: []string{"ro"},
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		Secrets: map[string]string{"password": "123"},
+	}
+
+	cases := []struct {
+		object   zapcore.ObjectMarshaler
+		expected string
+	}{
+		{Object(createVolume),
+			`{"request":{"name":"test-volume","capacity_range":{"required_bytes":1024},"volume_capabilities":[{"access_mode":{"mode":"SINGLE_NODE_WRITER"},"mount":{"fs_type":"ext4","mount_flags":["ro"]}}],"secrets":"***stripped***"}}`,
+		},
+		{ObjectWith(protosanitizer.New(protosanitizer.WithRedactor(protosanitizer.KeysOnly())), &csi.NodeStageVolumeRequest{VolumeId: "vol", Secrets: map[string]string{"password": "123"}}),
+			`{"request":{"volume_id":"vol","secrets":{"password":"***stripped***"}}}`,
+		},
+		{Object("hello"), `{"request":{"value":"\"hello\""}}`},
+	}
+
+	for _, c := range cases {
+		enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
+		buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{
+			{Key: "request", Type: zapcore.ObjectMarshalerType, Interface: c.object},
+		})
+		if assert.NoError(t, err, "EncodeEntry") {
+			assert.Equal(t, c.expected+"\n", buf.String())
+		}
+	}
+}
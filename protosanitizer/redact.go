@@ -0,0 +1,256 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Redactor determines what gets logged instead of a secret.
+type Redactor interface {
+	// Redact returns the replacement for a secret value. The value
+	// is the content of a scalar field (a string, bytes or the
+	// decimal representation of a number or boolean) or of one
+	// entry in a secret map. It is nil for everything else, for
+	// example messages or repeated fields.
+	Redact(value []byte) string
+
+	// MapKeys determines whether the keys of secret maps get logged,
+	// with each value replaced individually, or whether the entire map
+	// gets replaced with the result of Redact(nil).
+	MapKeys() bool
+}
+
+const defaultMarker = "***stripped***"
+
+// FixedMarker replaces each secret field with the marker, without
+// revealing anything about the secret. StripSecrets uses this with
+// "***stripped***" as marker.
+func FixedMarker(marker string) Redactor {
+	return fixedMarker(marker)
+}
+
+type fixedMarker string
+
+func (m fixedMarker) Redact(value []byte) string { return string(m) }
+func (m fixedMarker) MapKeys() bool              { return false }
+
+// KeysOnly shows which keys were set in secret maps, like the
+// secrets map in a CreateVolumeRequest, while all values are replaced
+// with "***stripped***".
+func KeysOnly() Redactor {
+	return keysOnly{}
+}
+
+type keysOnly struct{}
+
+func (keysOnly) Redact(value []byte) string { return defaultMarker }
+func (keysOnly) MapKeys() bool              { return true }
+
+// ValueLength replaces secret values with their length, for example
+// "***stripped (8 bytes)***". The keys of secret maps are logged.
+func ValueLength() Redactor {
+	return valueLength{}
+}
+
+type valueLength struct{}
+
+func (valueLength) Redact(value []byte) string {
+	if value == nil {
+		return defaultMarker
+	}
+	return fmt.Sprintf("***stripped (%d bytes)***", len(value))
+}
+func (valueLength) MapKeys() bool { return true }
+
+// HMACFingerprint replaces secret values with the beginning of their
+// HMAC-SHA256, for example "***stripped hmac-sha256:0123456789abcdef***".
+// This makes it possible to tell whether two calls used the same
+// credentials without revealing them, as long as the key is kept
+// secret. The keys of secret maps are logged.
+//
+// The key must be at least MinHMACKeyLength bytes long, otherwise
+// HMACFingerprint returns an error. A short or empty key would make
+// it easy to find the secrets by trying out likely values.
+func HMACFingerprint(key []byte) (Redactor, error) {
+	if len(key) < MinHMACKeyLength {
+		return nil, fmt.Errorf("HMAC key must have at least %d bytes, got %d", MinHMACKeyLength, len(key))
+	}
+	return hmacFingerprint{key: append([]byte(nil), key...)}, nil
+}
+
+// MustHMACFingerprint is like HMACFingerprint, except that it panics
+// if the key is too short. It is meant for keys that are known to be
+// valid, for example because they are hard-coded.
+func MustHMACFingerprint(key []byte) Redactor {
+	redactor, err := HMACFingerprint(key)
+	if err != nil {
+		panic("MustHMACFingerprint: " + err.Error())
+	}
+	return redactor
+}
+
+// MinHMACKeyLength is the minimum length of the key for HMACFingerprint.
+const MinHMACKeyLength = 16
+
+type hmacFingerprint struct {
+	key []byte
+}
+
+func (h hmacFingerprint) Redact(value []byte) string {
+	if value == nil {
+		return defaultMarker
+	}
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(value)
+	return fmt.Sprintf("***stripped hmac-sha256:%x***", mac.Sum(nil)[:8])
+}
+func (hmacFingerprint) MapKeys() bool { return true }
+
+// secret writes the replacement for the value of a secret field
+// in a Go struct.
+func (e *encoder) secret(v reflect.Value) {
+	if e.redactor == nil {
+		e.string(defaultMarker)
+		return
+	}
+	if v.Kind() != reflect.Map || !e.redactor.MapKeys() {
+		e.secretValue(v)
+		return
+	}
+	keys := sortedKeys(v)
+	n := e.entries(len(keys))
+	e.buf.WriteByte('{')
+	for i, key := range keys[:n] {
+		if e.stop() {
+			break
+		}
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.string(key.name)
+		e.buf.WriteByte(':')
+		e.secretValue(v.MapIndex(key.value))
+	}
+	e.moreEntries(len(keys)-n, true)
+	e.buf.WriteByte('}')
+}
+
+// secretValue writes the replacement for a single secret value.
+func (e *encoder) secretValue(v reflect.Value) {
+	if e.redactor == nil {
+		e.string(defaultMarker)
+		return
+	}
+	e.string(e.redactor.Redact(scalarBytes(v)))
+}
+
+// scalarBytes returns the content of a scalar value, nil for all other values.
+func scalarBytes(v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte{}, v.Bytes()...)
+		}
+	case reflect.Bool:
+		return strconv.AppendBool([]byte{}, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt([]byte{}, v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint([]byte{}, v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat([]byte{}, v.Float(), 'g', -1, 64)
+	}
+	return nil
+}
+
+// reflectSecret writes the replacement for the value of a secret
+// field in an APIv2 message.
+func (e *encoder) reflectSecret(field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	switch {
+	case e.redactor == nil:
+		e.string(defaultMarker)
+	case field.IsList():
+		e.string(e.redactor.Redact(nil))
+	case field.IsMap() && e.redactor.MapKeys():
+		m := v.Map()
+		keys := e.mapKeys(field, m)
+		n := e.entries(len(keys))
+		e.buf.WriteByte('{')
+		for i, key := range keys[:n] {
+			if e.stop() {
+				break
+			}
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.string(key.String())
+			e.buf.WriteByte(':')
+			e.reflectSecretValue(field.MapValue(), m.Get(key))
+		}
+		e.moreEntries(len(keys)-n, true)
+		e.buf.WriteByte('}')
+	case field.IsMap():
+		e.string(e.redactor.Redact(nil))
+	default:
+		e.reflectSecretValue(field, v)
+	}
+}
+
+// reflectSecretValue writes the replacement for a single secret value.
+func (e *encoder) reflectSecretValue(field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	e.string(e.redacted(field, v))
+}
+
+// redacted returns the replacement for a single secret value.
+func (e *encoder) redacted(field protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	if e.redactor == nil {
+		return defaultMarker
+	}
+	return e.redactor.Redact(reflectScalarBytes(field, v))
+}
+
+// reflectScalarBytes returns the content of a scalar value, nil for all other values.
+func reflectScalarBytes(field protoreflect.FieldDescriptor, v protoreflect.Value) []byte {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return []byte(v.String())
+	case protoreflect.BytesKind:
+		return append([]byte{}, v.Bytes()...)
+	case protoreflect.BoolKind:
+		return strconv.AppendBool([]byte{}, v.Bool())
+	case protoreflect.EnumKind:
+		return strconv.AppendInt([]byte{}, int64(v.Enum()), 10)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return strconv.AppendInt([]byte{}, v.Int(), 10)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.AppendUint([]byte{}, v.Uint(), 10)
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return strconv.AppendFloat([]byte{}, v.Float(), 'g', -1, 64)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// SanitizeMessage returns a deep copy of the message in which all
+// secret fields are replaced, including those in nested messages,
+// repeated fields, maps and oneofs. The original message is not
+// modified. The result has the same Go type as msg.
+//
+// Unknown fields are dropped because they might be secret fields
+// which were added in a newer revision of the spec.
+//
+// Secret strings, including the values of secret string maps and the
+// entries of repeated string fields, are set to "***stripped***", so
+// it remains visible that they were set. All other secret fields are
+// cleared.
+//
+// Secrets are found the same way as in StripSecrets.
+func SanitizeMessage(msg proto.Message) proto.Message {
+	return defaultSanitizer.SanitizeMessage(msg)
+}
+
+// SanitizeMessage is like the package level SanitizeMessage, except
+// that the secret predicate and paths of the sanitizer are used. The
+// other options only affect the output of StripSecrets.
+func (s *Sanitizer) SanitizeMessage(msg proto.Message) proto.Message {
+	if msg == nil {
+		return nil
+	}
+	clone := protov2.Clone(protoimpl.X.ProtoMessageV2Of(msg))
+	s.rules.sanitize(clone.ProtoReflect(), false)
+	return protoimpl.X.ProtoMessageV1Of(clone)
+}
+
+// WipeSecrets removes all secrets from the message itself, including
+// those in nested messages, repeated fields, maps and oneofs. It is
+// meant to be called once the secrets are no longer needed, for
+// example after a CreateVolumeRequest has been handled, to shorten
+// the time that they are kept in memory.
+//
+// Bytes fields and the raw bytes of unknown fields get overwritten
+// with zeros before they get cleared. Go strings are immutable, so
+// for strings all that can be done is to drop the references to them
+// and let the garbage collector reclaim the memory.
+//
+// Secrets are found the same way as in StripSecrets.
+func WipeSecrets(msg proto.Message) {
+	defaultSanitizer.WipeSecrets(msg)
+}
+
+// WipeSecrets is like the package level WipeSecrets, except that the
+// secret predicate and paths of the sanitizer are used.
+func (s *Sanitizer) WipeSecrets(msg proto.Message) {
+	if msg == nil {
+		return
+	}
+	s.rules.sanitize(protoimpl.X.ProtoMessageV2Of(msg).ProtoReflect(), true)
+}
+
+// sanitize replaces all secrets in the message or, if wipe is true,
+// zeroes and clears them.
+func (r *secretRules) sanitize(m protoreflect.Message, wipe bool) {
+	if !m.IsValid() {
+		return
+	}
+	// Unknown fields may be secrets that were added in a newer
+	// revision of the spec.
+	if wipe {
+		zeroUnknown(m)
+	}
+	m.SetUnknown(nil)
+	if isAny(m.Descriptor()) {
+		r.sanitizeAny(m, wipe)
+		return
+	}
+	// The plan for proto3 JSON covers all fields, including
+	// those in oneofs.
+	plan := r.protoJSONPlan(m.Descriptor())
+	for i := range plan.entries {
+		entry := &plan.entries[i]
+		field := entry.field
+		if !m.Has(field) {
+			continue
+		}
+		switch {
+		case entry.secret && wipe:
+			wipeValue(field, m.Get(field))
+			m.Clear(field)
+		case entry.secret:
+			replaceSecret(m, field)
+		case field.IsMap():
+			mv := m.Mutable(field).Map()
+			mv.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+				switch {
+				case entry.keys != nil && entry.keys.secret(key.String()) && wipe:
+					zeroBytes(field.MapValue(), value)
+					mv.Clear(key)
+				case entry.keys != nil && entry.keys.secret(key.String()):
+					if field.MapValue().Kind() == protoreflect.StringKind {
+						mv.Set(key, protoreflect.ValueOfString(defaultMarker))
+					} else {
+						mv.Clear(key)
+					}
+				case isMessage(field.MapValue()):
+					r.sanitize(value.Message(), wipe)
+				}
+				return true
+			})
+		case field.IsList() && isMessage(field):
+			list := m.Mutable(field).List()
+			for i := 0; i < list.Len(); i++ {
+				r.sanitize(list.Get(i).Message(), wipe)
+			}
+		case isMessage(field):
+			r.sanitize(m.Mutable(field).Message(), wipe)
+		}
+	}
+}
+
+// replaceSecret replaces the value of a secret field.
+func replaceSecret(m protoreflect.Message, field protoreflect.FieldDescriptor) {
+	marker := protoreflect.ValueOfString(defaultMarker)
+	switch {
+	case field.IsMap() && field.MapValue().Kind() == protoreflect.StringKind:
+		mv := m.Mutable(field).Map()
+		mv.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+			mv.Set(key, marker)
+			return true
+		})
+	case field.IsList() && field.Kind() == protoreflect.StringKind:
+		list := m.Mutable(field).List()
+		for i := 0; i < list.Len(); i++ {
+			list.Set(i, marker)
+		}
+	case !field.IsMap() && !field.IsList() && field.Kind() == protoreflect.StringKind:
+		m.Set(field, marker)
+	default:
+		m.Clear(field)
+	}
+}
+
+// wipeValue zeroes the bytes in the value of the field and removes
+// all entries from maps. Clearing the field only drops the reference
+// from the message, other references to the map would still have the
+// secrets.
+func wipeValue(field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	zeroBytes(field, v)
+	if field.IsMap() {
+		mv := v.Map()
+		mv.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+			mv.Clear(key)
+			return true
+		})
+	}
+}
+
+// zeroBytes overwrites all bytes stored in the value of the field,
+// including those in nested messages.
+func zeroBytes(field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	switch {
+	case field.IsList():
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			zeroValue(field, list.Get(i))
+		}
+	case field.IsMap():
+		v.Map().Range(func(_ protoreflect.MapKey, value protoreflect.Value) bool {
+			zeroValue(field.MapValue(), value)
+			return true
+		})
+	default:
+		zeroValue(field, v)
+	}
+}
+
+// zeroValue overwrites the bytes in a single value of the field.
+func zeroValue(field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	switch {
+	case field.Kind() == protoreflect.BytesKind:
+		b := v.Bytes()
+		for i := range b {
+			b[i] = 0
+		}
+	case isMessage(field):
+		zeroUnknown(v.Message())
+		v.Message().Range(func(field protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			zeroBytes(field, v)
+			return true
+		})
+	}
+}
+
+// zeroUnknown overwrites the raw bytes of the unknown fields of the
+// message.
+func zeroUnknown(m protoreflect.Message) {
+	b := m.GetUnknown()
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func isMessage(field protoreflect.FieldDescriptor) bool {
+	return field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.GroupKind
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"fmt"
+
+	protobuf "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Sanitizer strips secrets from gRPC messages with a certain
+// configuration. It is meant to be created once, for example
+// during startup, and then can be used concurrently for all
+// log calls.
+//
+// The package level functions like StripSecrets are shortcuts for
+// sanitizers with a fixed configuration.
+type Sanitizer struct {
+	rules    *secretRules
+	isSecret func(field *protobuf.FieldDescriptorProto) bool
+	paths    pathPolicy
+	types    protoregistry.MessageTypeResolver
+	strict   bool
+	format   Format
+	redactor Redactor
+	maxSize  int
+	maxDepth int
+
+	maxEntries      int
+	maxStringLength int
+	heuristics      *heuristics
+}
+
+// Option changes the configuration of a Sanitizer.
+type Option func(s *Sanitizer)
+
+// New creates a Sanitizer. Without options, it behaves like
+// StripSecrets.
+func New(opts ...Option) *Sanitizer {
+	s := &Sanitizer{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.isSecret == nil && len(s.paths.redact) == 0 && s.types == nil {
+		s.rules = defaultRules
+	} else {
+		s.rules = &secretRules{isSecretField: s.isSecret, paths: s.paths, types: s.types}
+	}
+	return s
+}
+
+// StripSecrets returns a wrapper around the original gRPC message
+// which has a Stringer implementation that serializes the message
+// according to the configuration of the sanitizer. Like the
+// package level StripSecrets, it is cheap and defers all work
+// until the result gets converted to a string or written with
+// io.WriterTo or fmt.Formatter.
+func (s *Sanitizer) StripSecrets(msg interface{}) fmt.Stringer {
+	return &stripSecrets{msg: msg, sanitizer: s}
+}
+
+// Format selects how messages get serialized.
+type Format int
+
+const (
+	// FormatJSON is one-line JSON based on the struct tags of
+	// the Go types generated for golang/protobuf APIv1. This
+	// is the default.
+	FormatJSON Format = iota
+	// FormatProtoJSON is canonical proto3 JSON, see StripSecretsProtoJSON.
+	FormatProtoJSON
+	// FormatText is the protobuf text format on a single line.
+	FormatText
+	// FormatLogfmt writes one key=value pair per value, with the
+	// path of the field as key:
+	//
+	//	capacity_range.required_bytes=1024 secrets=***stripped***
+	//
+	// The path joins field names with dots and appends [i] for
+	// list entries. Map keys which consist only of ASCII letters,
+	// digits, underscores and dashes (but not a leading dash) are
+	// appended like field names. All other map keys are put into
+	// brackets and escaped like strconv.Quote without the quotes,
+	// except that space, '=', '"' and ']' become \x20, \x3d, \x22
+	// and \x5d. The key therefore never contains a character that
+	// would end it:
+	//
+	//	parameters[csi.example.com/fs\x20type]=ext4
+	//
+	// Values get quoted with strconv.Quote if they are empty or
+	// contain spaces, '=', '"' or control characters.
+	FormatLogfmt
+	// FormatYAML is a multi-line YAML document.
+	FormatYAML
+)
+
+// WithSecretPredicate determines which fields contain secrets. The
+// default picks IsCSI1Secret or IsCSI03Secret based on the package
+// of each message, see StripSecrets.
+func WithSecretPredicate(isSecret func(field *protobuf.FieldDescriptorProto) bool) Option {
+	return func(s *Sanitizer) {
+		s.isSecret = isSecret
+	}
+}
+
+// WithRedactedPaths redacts fields and map entries in addition to
+// those selected by the secret predicate. Each path consists of a
+// message name, a field name and, for map fields, optionally a key,
+// separated by dots:
+//
+//	CreateVolumeRequest.parameters.password
+//	*.volume_context.*token*
+//	csi.v1.NodeStageVolumeRequest.publish_context
+//
+// The message name can be used with or without the package. Fields
+// are referenced by their name in the .proto file. A * matches any
+// sequence of characters, including dots, and a ? matches a single
+// character. Map keys may contain dots, everything after the field
+// name is the key.
+//
+// Paths apply to the message which directly contains the field,
+// so for nested messages the name of the nested message must be
+// used (Volume.volume_context instead of
+// CreateVolumeResponse.volume.volume_context).
+func WithRedactedPaths(paths ...string) Option {
+	return func(s *Sanitizer) {
+		s.paths.redact = append(s.paths.redact, paths...)
+	}
+}
+
+// WithAllowedPaths defines exceptions for WithRedactedPaths, using
+// the same syntax. For example, "*.parameters.*" together with the
+// allowed path "*.parameters.fsType" shows only that parameter.
+// Allowed paths have no effect on fields selected by the secret
+// predicate.
+func WithAllowedPaths(paths ...string) Option {
+	return func(s *Sanitizer) {
+		s.paths.allow = append(s.paths.allow, paths...)
+	}
+}
+
+// WithMessageTypes adds message types for the messages embedded in
+// google.protobuf.Any. They are looked up there first, then among
+// the types which are compiled into the binary. The types of a
+// DescriptorSet can be used for messages decoded at runtime.
+func WithMessageTypes(types protoregistry.MessageTypeResolver) Option {
+	return func(s *Sanitizer) {
+		s.types = types
+	}
+}
+
+// WithMarker replaces the default "***stripped***" marker for secret
+// values. It is a shortcut for WithRedactor(FixedMarker(marker)).
+func WithMarker(marker string) Option {
+	return WithRedactor(FixedMarker(marker))
+}
+
+// WithRedactor determines what gets logged instead of secret values,
+// see StripSecretsRedacted.
+func WithRedactor(redactor Redactor) Option {
+	return func(s *Sanitizer) {
+		s.redactor = redactor
+	}
+}
+
+// WithFormat selects the output format. The default is FormatJSON.
+func WithFormat(format Format) Option {
+	return func(s *Sanitizer) {
+		s.format = format
+	}
+}
+
+// WithStrict enables failing closed, see StripSecretsStrict.
+func WithStrict() Option {
+	return func(s *Sanitizer) {
+		s.strict = true
+	}
+}
+
+// WithMaxSize limits the size of the result. Longer output gets cut
+// off after roughly that many bytes and ends with "...(truncated)",
+// so it is no longer valid JSON. Zero, the default, means no limit.
+// The limit applies to the serialized output only, the structured
+// values from LogValue and MarshalLog are not limited by it.
+func WithMaxSize(bytes int) Option {
+	return func(s *Sanitizer) {
+		s.maxSize = bytes
+	}
+}
+
+// WithMaxDepth limits how deeply nested messages are included.
+// Messages below that depth are replaced with "...(max depth)".
+// The message passed to StripSecrets has depth 1. Zero, the default,
+// means no limit.
+func WithMaxDepth(depth int) Option {
+	return func(s *Sanitizer) {
+		s.maxDepth = depth
+	}
+}
+
+// WithMaxEntries limits how many entries of repeated fields and
+// maps are included. The remaining entries are replaced with a
+// placeholder like "...(4821 more entries)", which for maps is
+// stored under the key "...". Zero, the default, means no limit.
+func WithMaxEntries(entries int) Option {
+	return func(s *Sanitizer) {
+		s.maxEntries = entries
+	}
+}
+
+// WithMaxStringLength limits the length of string and bytes fields.
+// Longer values get shortened to that many bytes and end with
+// a placeholder like "...(1024 more bytes)". For bytes fields, the
+// limit applies before encoding as base64. Zero, the default, means
+// no limit.
+func WithMaxStringLength(bytes int) Option {
+	return func(s *Sanitizer) {
+		s.maxStringLength = bytes
+	}
+}
+
+// WithHeuristics enables redacting of secrets which are not annotated
+// in the .proto file, for example credentials which a driver passes
+// in parameters or volume_context. Map entries are redacted if their
+// key matches one of the glob patterns (case-insensitive, same syntax
+// as in WithRedactedPaths). Without patterns, *password*, *passwd*,
+// *token*, *secret* and *key* are used. In addition, all string values
+// which contain a PEM block, a JWT or an AWS access key ID are
+// redacted.
+//
+// The marker names the rule that matched, for example
+// "***stripped: key pattern *password* matched***". Heuristics may
+// redact more than necessary and cannot find all secrets, so
+// they are only a safety net for the spec annotations.
+func WithHeuristics(keyPatterns ...string) Option {
+	return func(s *Sanitizer) {
+		s.heuristics = newHeuristics(keyPatterns)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command secretlint reports fields which look like they contain
+// credentials, but which are not annotated with csi_secret and
+// therefore do not get stripped by protosanitizer:
+//
+//	secretlint -I . -I $GOPATH/src vendor/driver.proto
+//	protoc --include_source_info --descriptor_set_out=driver.pb vendor/driver.proto && secretlint driver.pb
+//
+// Arguments ending in .proto are parsed, all others are read as
+// serialized FileDescriptorSet. The exit code is 1 if some field
+// gets reported and 2 if loading the files fails, so the command
+// can be used as a check in the build of a CSI driver.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer/secretlint"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type importPaths []string
+
+func (i *importPaths) String() string     { return strings.Join(*i, ",") }
+func (i *importPaths) Set(s string) error { *i = append(*i, s); return nil }
+
+func main() {
+	var paths importPaths
+	flag.Var(&paths, "I", "directory in which to search for imports of .proto files, may be given more than once (default \".\")")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-I path] file.proto|descriptor-set ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var files []protoreflect.FileDescriptor
+	var protos []string
+	for _, arg := range flag.Args() {
+		if strings.HasSuffix(arg, ".proto") {
+			protos = append(protos, arg)
+			continue
+		}
+		set, err := secretlint.ReadDescriptorSet(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		files = append(files, set...)
+	}
+	if len(protos) > 0 {
+		parsed, err := secretlint.ParseFiles(paths, protos...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		files = append(files, parsed...)
+	}
+
+	findings := secretlint.Check(files...)
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
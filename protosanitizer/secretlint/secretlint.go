@@ -0,0 +1,264 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secretlint finds fields in protobuf descriptors which look
+// like they contain credentials, but which protosanitizer does not
+// strip because they are not annotated with csi_secret.
+//
+// The descriptors can be parsed from .proto files with ParseFiles
+// or read from a serialized FileDescriptorSet with ReadDescriptorSet.
+package secretlint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// credentialWords are parts of field names and comments which
+// suggest that a field holds credentials. They are compared
+// against the lower case words of the name or comment.
+var credentialWords = []string{
+	"password", "passwd", "passphrase",
+	"secret", "secrets",
+	"token", "tokens",
+	"credential", "credentials",
+	"apikey", "privatekey",
+}
+
+// nameOnlyWords are credential words which are also used in other
+// meanings, for example in "a token for pagination". They only count
+// in field names, not in comments.
+var nameOnlyWords = []string{"secret", "secrets", "token", "tokens"}
+
+// credentialPhrases are pairs of words with the same meaning.
+var credentialPhrases = [][2]string{
+	{"api", "key"},
+	{"private", "key"},
+	{"access", "key"},
+	{"secret", "key"},
+}
+
+// paginationWords precede "token" in names like next_token, where
+// the token is used for paging through results.
+var paginationWords = []string{"starting", "next", "page", "continuation"}
+
+// referenceWords end the names of fields which only refer to
+// credentials stored elsewhere, like secret_name or token_file.
+var referenceWords = []string{"name", "namespace", "ref", "id", "file", "path", "url", "type"}
+
+// Finding describes a field which looks like it contains
+// credentials but is not treated as secret by protosanitizer.
+type Finding struct {
+	Field protoreflect.FieldDescriptor
+	// Reason explains why the field looks like it contains credentials.
+	Reason string
+}
+
+// String returns the position of the field, if known, its name and
+// the reason, for example
+//
+//	vendor.proto:12:5: vendor.v1.Login.password: field name contains "password" but (csi.v1.csi_secret) = true is missing
+func (f Finding) String() string {
+	pos := f.Field.ParentFile().Path()
+	loc := f.Field.ParentFile().SourceLocations().ByDescriptor(f.Field)
+	if loc.Path != nil {
+		pos = fmt.Sprintf("%s:%d:%d", pos, loc.StartLine+1, loc.StartColumn+1)
+	}
+	return fmt.Sprintf("%s: %s: %s but (csi.v1.csi_secret) = true is missing", pos, f.Field.FullName(), f.Reason)
+}
+
+// Check returns the fields of the messages in the files which look
+// like they contain credentials according to their name or comments,
+// but which protosanitizer.IsSecretField does not consider secret.
+func Check(files ...protoreflect.FileDescriptor) []Finding {
+	var findings []Finding
+	for _, file := range files {
+		findings = checkMessages(file.Messages(), findings)
+	}
+	return findings
+}
+
+func checkMessages(messages protoreflect.MessageDescriptors, findings []Finding) []Finding {
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		fields := md.Fields()
+		for j := 0; j < fields.Len(); j++ {
+			field := fields.Get(j)
+			reason := suspicious(field)
+			if reason != "" && !protosanitizer.IsSecretField(field) {
+				findings = append(findings, Finding{Field: field, Reason: reason})
+			}
+		}
+		findings = checkMessages(md.Messages(), findings)
+	}
+	return findings
+}
+
+// suspicious returns the reason why the field looks like it holds
+// credentials, or an empty string if it does not. Only fields which
+// can hold text or binary data are considered.
+func suspicious(field protoreflect.FieldDescriptor) string {
+	kind := field.Kind()
+	if field.IsMap() {
+		kind = field.MapValue().Kind()
+	}
+	switch kind {
+	case protoreflect.StringKind, protoreflect.BytesKind, protoreflect.MessageKind, protoreflect.GroupKind:
+	default:
+		return ""
+	}
+	name := words(string(field.Name()))
+	if len(name) > 0 && contains(referenceWords, name[len(name)-1]) {
+		return ""
+	}
+	if word := credentialWord(name, false); word != "" {
+		return fmt.Sprintf("field name contains %q", word)
+	}
+	loc := field.ParentFile().SourceLocations().ByDescriptor(field)
+	for _, comment := range []string{loc.LeadingComments, loc.TrailingComments} {
+		if word := credentialWord(words(comment), true); word != "" {
+			return fmt.Sprintf("comment mentions %q", word)
+		}
+	}
+	return ""
+}
+
+// credentialWord returns the first word or phrase which suggests
+// credentials, using stricter rules for comments.
+func credentialWord(words []string, comment bool) string {
+	for i, word := range words {
+		if comment && contains(nameOnlyWords, word) ||
+			strings.HasPrefix(word, "token") && i > 0 && contains(paginationWords, words[i-1]) {
+			continue
+		}
+		if contains(credentialWords, word) {
+			return word
+		}
+		if i+1 < len(words) {
+			for _, phrase := range credentialPhrases {
+				if word == phrase[0] && words[i+1] == phrase[1] {
+					return word + " " + words[i+1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// words splits names in snake or camel case and comments into lower
+// case words.
+func words(s string) []string {
+	var result []string
+	var word []rune
+	var prev rune
+	flush := func() {
+		if len(word) > 0 {
+			result = append(result, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+		prev = r
+	}
+	flush()
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFiles parses and links the .proto files, including the source
+// information with comments. Imports are searched for in the import
+// paths, with the current directory as default. The standard imports
+// like google/protobuf/descriptor.proto are always available. Only
+// the named files are returned, not their imports.
+func ParseFiles(importPaths []string, names ...string) ([]protoreflect.FileDescriptor, error) {
+	if len(importPaths) == 0 {
+		importPaths = []string{"."}
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: importPaths,
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	linked, err := compiler.Compile(context.Background(), names...)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]protoreflect.FileDescriptor, 0, len(linked))
+	for _, file := range linked {
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ReadDescriptorSet reads a serialized FileDescriptorSet, as written
+// by "protoc --descriptor_set_out". Include --include_source_info to
+// get comments and positions. Imports which are not part of the set
+// are allowed; fields using their types are still checked.
+func ReadDescriptorSet(filename string) ([]protoreflect.FileDescriptor, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	registry := &protoregistry.Files{}
+	files := make([]protoreflect.FileDescriptor, 0, len(set.File))
+	for _, fdp := range set.File {
+		file, err := protodesc.FileOptions{AllowUnresolvable: true}.New(fdp, registry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", filename, fdp.GetName(), err)
+		}
+		if err := registry.RegisterFile(file); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", filename, fdp.GetName(), err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
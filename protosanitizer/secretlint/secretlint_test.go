@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretlint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const csiProto = `syntax = "proto3";
+package csi.v1;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.FieldOptions {
+  bool csi_secret = 1059;
+}
+`
+
+const vendorProto = `syntax = "proto3";
+package vendor.v1;
+
+import "csi.proto";
+
+message Login {
+  string user = 1;
+  string password = 2;
+  map<string, string> secrets = 3 [(csi.v1.csi_secret) = true];
+  // The credentials for the storage backend.
+  bytes blob = 4;
+  string secret_name = 5;
+  bool use_token = 6;
+  string next_token = 7;
+  // A token for paging.
+  string cursor = 8;
+
+  message Nested {
+    string apiKey = 1;
+  }
+}
+`
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"csi.proto": csiProto, "vendor.proto": vendorProto} {
+		if !assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)) {
+			return
+		}
+	}
+	files, err := ParseFiles([]string{dir}, "vendor.proto")
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected := []string{
+		`vendor.proto:8:3: vendor.v1.Login.password: field name contains "password" but (csi.v1.csi_secret) = true is missing`,
+		`vendor.proto:11:3: vendor.v1.Login.blob: comment mentions "credentials" but (csi.v1.csi_secret) = true is missing`,
+		`vendor.proto:19:5: vendor.v1.Login.Nested.apiKey: field name contains "api key" but (csi.v1.csi_secret) = true is missing`,
+	}
+	assert.Equal(t, expected, findings(Check(files...)))
+
+	// The same from a descriptor set, with the dependency
+	// and without source information.
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range []protoreflect.FileDescriptor{files[0].Imports().Get(0), files[0]} {
+		fdp := protodesc.ToFileDescriptorProto(file)
+		fdp.SourceCodeInfo = nil
+		set.File = append(set.File, fdp)
+	}
+	data, err := proto.Marshal(set)
+	if !assert.NoError(t, err) {
+		return
+	}
+	filename := filepath.Join(dir, "vendor.pb")
+	if !assert.NoError(t, os.WriteFile(filename, data, 0644)) {
+		return
+	}
+	files, err = ReadDescriptorSet(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{
+		`vendor.proto: vendor.v1.Login.password: field name contains "password" but (csi.v1.csi_secret) = true is missing`,
+		`vendor.proto: vendor.v1.Login.Nested.apiKey: field name contains "api key" but (csi.v1.csi_secret) = true is missing`,
+	}, findings(Check(files...)))
+
+	_, err = ParseFiles([]string{dir}, "missing.proto")
+	assert.Error(t, err)
+}
+
+func findings(findings []Finding) []string {
+	var result []string
+	for _, finding := range findings {
+		result = append(result, finding.String())
+	}
+	return result
+}
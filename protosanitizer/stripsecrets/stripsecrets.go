@@ -0,0 +1,385 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package stripsecrets defines an analyzer which reports protobuf
+// messages that may contain secrets and get logged without
+// protosanitizer.StripSecrets.
+//
+// A message may contain secrets if it is a request or response of
+// the CSI spec or if it has a field, directly or in one of its nested
+// messages, whose name ends in "secret" or "secrets". The csi_secret
+// field option itself is not visible in the generated Go code.
+//
+// This is only a heuristic. Secret fields with other names, for
+// example "password" or "token", are not detected outside of the
+// CSI messages, so the absence of a report does not mean that a
+// message is safe to log.
+//
+// Such messages get reported when they are passed as interface value
+// to a function or method of fmt, log, log/slog, k8s.io/klog,
+// github.com/golang/glog or go.uber.org/zap, for example:
+//
+//	klog.V(5).Infof("GRPC request: %+v", req)
+//
+// The suggested fix wraps the argument:
+//
+//	klog.V(5).Infof("GRPC request: %+v", protosanitizer.StripSecrets(req))
+package stripsecrets
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Analyzer reports messages with secrets that get passed to logging
+// functions.
+var Analyzer = &analysis.Analyzer{
+	Name:     "stripsecrets",
+	Doc:      "report protobuf messages with secrets that get logged without protosanitizer.StripSecrets",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+const protosanitizerPath = "github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+
+// loggingPackages are the packages whose functions and methods
+// write their arguments somewhere.
+var loggingPackages = map[string]bool{
+	"fmt":                    true,
+	"log":                    true,
+	"log/slog":               true,
+	"k8s.io/klog":            true,
+	"k8s.io/klog/v2":         true,
+	"github.com/golang/glog": true,
+	"go.uber.org/zap":        true,
+}
+
+// csiPackages are the import paths of the Go bindings of the CSI spec.
+var csiPackages = map[string]bool{
+	"github.com/container-storage-interface/spec/lib/go/csi":    true,
+	"github.com/container-storage-interface/spec/lib/go/csi/v0": true,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	c := &checker{
+		pass:    pass,
+		secrets: map[*types.Named]bool{},
+	}
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		c.call(n.(*ast.CallExpr))
+	})
+	return nil, nil
+}
+
+type checker struct {
+	pass *analysis.Pass
+
+	// secrets caches the result of hasSecrets. Messages which are
+	// currently being checked are stored as false, which ends
+	// the recursion for messages which contain themselves.
+	secrets map[*types.Named]bool
+}
+
+// call reports the arguments of a logging call which may contain secrets.
+func (c *checker) call(call *ast.CallExpr) {
+	fn, ok := typeutil.Callee(c.pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return
+	}
+	path := unvendor(fn.Pkg().Path())
+	if !loggingPackages[path] || path == "fmt" && isScan(fn.Name()) {
+		return
+	}
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok {
+		return
+	}
+	params := sig.Params()
+	for i, arg := range call.Args {
+		var param types.Type
+		switch {
+		case sig.Variadic() && i >= params.Len()-1:
+			if call.Ellipsis.IsValid() {
+				continue
+			}
+			param = params.At(params.Len() - 1).Type().(*types.Slice).Elem()
+		case i < params.Len():
+			param = params.At(i).Type()
+		default:
+			continue
+		}
+		if !types.IsInterface(param) {
+			continue
+		}
+		msg := message(c.pass.TypesInfo.TypeOf(arg))
+		if msg == nil || !c.hasSecrets(msg) {
+			continue
+		}
+		c.report(call, arg, fn)
+	}
+}
+
+// report emits a diagnostic for the argument, with a fix which wraps
+// the argument in protosanitizer.StripSecrets.
+func (c *checker) report(call *ast.CallExpr, arg ast.Expr, fn *types.Func) {
+	file := c.file(call.Pos())
+	name, importEdit := c.importName(file)
+	strip := "StripSecrets("
+	if name != "." {
+		strip = name + "." + strip
+	}
+	edits := []analysis.TextEdit{
+		{Pos: arg.Pos(), End: arg.Pos(), NewText: []byte(strip)},
+		{Pos: arg.End(), End: arg.End(), NewText: []byte(")")},
+	}
+	if importEdit != nil {
+		edits = append(edits, *importEdit)
+	}
+	qualifier := func(pkg *types.Package) string { return pkg.Name() }
+	c.pass.Report(analysis.Diagnostic{
+		Pos: arg.Pos(),
+		End: arg.End(),
+		Message: fmt.Sprintf("%s may contain secrets and is passed to %s without protosanitizer.StripSecrets",
+			types.TypeString(c.pass.TypesInfo.TypeOf(arg), qualifier), callName(fn)),
+		SuggestedFixes: []analysis.SuggestedFix{{
+			Message:   "Wrap with protosanitizer.StripSecrets",
+			TextEdits: edits,
+		}},
+	})
+}
+
+// file returns the file which contains the position.
+func (c *checker) file(pos token.Pos) *ast.File {
+	tf := c.pass.Fset.File(pos)
+	for _, f := range c.pass.Files {
+		if c.pass.Fset.File(f.Pos()) == tf {
+			return f
+		}
+	}
+	return nil
+}
+
+// importName returns the name under which protosanitizer is
+// imported in the file. If it is not imported yet, the edit
+// adds the import.
+func (c *checker) importName(file *ast.File) (string, *analysis.TextEdit) {
+	if file == nil {
+		return "protosanitizer", nil
+	}
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != protosanitizerPath {
+			continue
+		}
+		if spec.Name == nil {
+			return "protosanitizer", nil
+		}
+		if spec.Name.Name != "_" {
+			return spec.Name.Name, nil
+		}
+	}
+	var last *ast.GenDecl
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			last = gen
+		}
+	}
+	line := strconv.Quote(protosanitizerPath)
+	switch {
+	case last == nil:
+		pos := file.Name.End()
+		return "protosanitizer", &analysis.TextEdit{Pos: pos, End: pos, NewText: []byte("\n\nimport " + line)}
+	case last.Rparen.IsValid():
+		pos := last.Rparen
+		text := "\t" + line + "\n"
+		// The closing parenthesis may follow the last import on
+		// the same line, as in import ("fmt").
+		prev := last.Lparen
+		if len(last.Specs) > 0 {
+			prev = last.Specs[len(last.Specs)-1].End()
+		}
+		if c.pass.Fset.Position(prev).Line == c.pass.Fset.Position(pos).Line {
+			text = "\n" + text
+		}
+		return "protosanitizer", &analysis.TextEdit{Pos: pos, End: pos, NewText: []byte(text)}
+	default:
+		pos := last.End()
+		return "protosanitizer", &analysis.TextEdit{Pos: pos, End: pos, NewText: []byte("\nimport " + line)}
+	}
+}
+
+// hasSecrets checks whether the message is part of the CSI spec
+// or has fields which look like they hold secrets.
+func (c *checker) hasSecrets(msg *types.Named) bool {
+	if secret, ok := c.secrets[msg]; ok {
+		return secret
+	}
+	c.secrets[msg] = false
+	secret := isCSIMessage(msg) || c.hasSecretFields(msg)
+	c.secrets[msg] = secret
+	return secret
+}
+
+func (c *checker) hasSecretFields(msg *types.Named) bool {
+	st, ok := msg.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() || strings.HasPrefix(field.Name(), "XXX_") {
+			continue
+		}
+		tag := reflect.StructTag(st.Tag(i))
+		if isSecretName(fieldName(field, tag)) {
+			return true
+		}
+		if tag.Get("protobuf_oneof") != "" {
+			if c.hasSecretAlternative(field) {
+				return true
+			}
+			continue
+		}
+		if nested := message(elem(field.Type())); nested != nil && c.hasSecrets(nested) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSecretAlternative checks the wrapper types which implement the
+// interface of a oneof field. They are generated in the same package.
+func (c *checker) hasSecretAlternative(field *types.Var) bool {
+	iface, ok := field.Type().Underlying().(*types.Interface)
+	if !ok || field.Pkg() == nil {
+		return false
+	}
+	scope := field.Pkg().Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok || !types.Implements(types.NewPointer(named), iface) {
+			continue
+		}
+		if _, ok := named.Underlying().(*types.Struct); ok && c.hasSecretFields(named) {
+			return true
+		}
+	}
+	return false
+}
+
+// message returns the named struct type if the type is a generated
+// protobuf message or a pointer to one.
+func message(t types.Type) *types.Named {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return nil
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return nil
+	}
+	methods := types.NewMethodSet(types.NewPointer(named))
+	if methods.Lookup(nil, "ProtoMessage") == nil && methods.Lookup(nil, "ProtoReflect") == nil {
+		return nil
+	}
+	return named
+}
+
+// elem returns the type of the entries of slices, arrays and maps.
+func elem(t types.Type) types.Type {
+	switch u := t.Underlying().(type) {
+	case *types.Slice:
+		return u.Elem()
+	case *types.Array:
+		return u.Elem()
+	case *types.Map:
+		return u.Elem()
+	}
+	return t
+}
+
+func isCSIMessage(msg *types.Named) bool {
+	obj := msg.Obj()
+	if obj.Pkg() == nil || !csiPackages[unvendor(obj.Pkg().Path())] {
+		return false
+	}
+	return strings.HasSuffix(obj.Name(), "Request") || strings.HasSuffix(obj.Name(), "Response")
+}
+
+// fieldName returns the field name from the .proto file, if the
+// struct tag has it, otherwise the Go name.
+func fieldName(field *types.Var, tag reflect.StructTag) string {
+	for _, part := range strings.Split(tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(part, "name=") {
+			return strings.TrimPrefix(part, "name=")
+		}
+	}
+	return field.Name()
+}
+
+// isSecretName is the name heuristic described in the package
+// documentation. It misses secret fields with other names.
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, "secret") || strings.HasSuffix(name, "secrets")
+}
+
+// isScan checks for the fmt functions which store into their
+// arguments instead of printing them.
+func isScan(name string) bool {
+	return strings.HasPrefix(name, "Scan") || strings.HasPrefix(name, "Sscan") || strings.HasPrefix(name, "Fscan")
+}
+
+// callName returns the name of a function or method like
+// "klog.Infof" or "klog.Verbose.Infof".
+func callName(fn *types.Func) string {
+	name := fn.Pkg().Name() + "."
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		t := recv.Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		if named, ok := t.(*types.Named); ok {
+			name += named.Obj().Name() + "."
+		}
+	}
+	return name + fn.Name()
+}
+
+// unvendor removes the vendor directory from an import path.
+func unvendor(path string) string {
+	if i := strings.LastIndex(path, "/vendor/"); i >= 0 {
+		return path[i+len("/vendor/"):]
+	}
+	return strings.TrimPrefix(path, "vendor/")
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stripsecrets
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const src = `package example
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+)
+
+type Request struct {
+	Name    string            ` + "`protobuf:\"bytes,1,opt,name=name,proto3\"`" + `
+	Secrets map[string]string ` + "`protobuf:\"bytes,2,rep,name=secrets,proto3\"`" + `
+}
+
+func (*Request) ProtoMessage() {}
+
+type Outer struct {
+	Inner []*Request ` + "`protobuf:\"bytes,1,rep,name=inner,proto3\"`" + `
+	Self  *Outer     ` + "`protobuf:\"bytes,2,opt,name=self,proto3\"`" + `
+}
+
+func (*Outer) ProtoMessage() {}
+
+type Choice struct {
+	Value isChoice_Value ` + "`protobuf_oneof:\"value\"`" + `
+}
+
+func (*Choice) ProtoMessage() {}
+
+type isChoice_Value interface{ isChoice_Value() }
+
+type Choice_Token struct {
+	Token string ` + "`protobuf:\"bytes,1,opt,name=api_secret,oneof\"`" + `
+}
+
+func (*Choice_Token) isChoice_Value() {}
+
+type Public struct {
+	SecretName string ` + "`protobuf:\"bytes,1,opt,name=secret_name,proto3\"`" + `
+}
+
+func (*Public) ProtoMessage() {}
+
+type strip struct{ msg interface{} }
+
+func (s strip) String() string { return "" }
+
+func f(req *Request, outer *Outer, choice *Choice, public *Public, logger *log.Logger, args []interface{}) {
+	fmt.Printf("%v %s", req, req.Name)
+	log.Println(outer)
+	logger.Print(choice)
+	slog.Info("request", "req", req)
+	fmt.Println(public, strip{req})
+	fmt.Println(args...)
+	fmt.Sscan("x", req)
+}
+`
+
+func TestAnalyzer(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "example.go", src, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check("example", fset, []*ast.File{file}, info)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var diagnostics []analysis.Diagnostic
+	pass := &analysis.Pass{
+		Analyzer:  Analyzer,
+		Fset:      fset,
+		Files:     []*ast.File{file},
+		Pkg:       pkg,
+		TypesInfo: info,
+		ResultOf:  map[*analysis.Analyzer]interface{}{inspect.Analyzer: inspector.New([]*ast.File{file})},
+		Report:    func(d analysis.Diagnostic) { diagnostics = append(diagnostics, d) },
+	}
+	_, err = Analyzer.Run(pass)
+	assert.NoError(t, err)
+
+	var messages []string
+	for _, d := range diagnostics {
+		messages = append(messages, fset.Position(d.Pos).String()+": "+d.Message)
+	}
+	assert.Equal(t, []string{
+		"example.go:48:22: *example.Request may contain secrets and is passed to fmt.Printf without protosanitizer.StripSecrets",
+		"example.go:49:14: *example.Outer may contain secrets and is passed to log.Println without protosanitizer.StripSecrets",
+		"example.go:50:15: *example.Choice may contain secrets and is passed to log.Logger.Print without protosanitizer.StripSecrets",
+		"example.go:51:30: *example.Request may contain secrets and is passed to slog.Info without protosanitizer.StripSecrets",
+	}, messages)
+
+	// Applying the first fix wraps the argument and adds the import.
+	if assert.NotEmpty(t, diagnostics) && assert.Len(t, diagnostics[0].SuggestedFixes, 1) {
+		edits := diagnostics[0].SuggestedFixes[0].TextEdits
+		sort.Slice(edits, func(i, j int) bool { return edits[i].Pos > edits[j].Pos })
+		fixed := src
+		for _, edit := range edits {
+			start, end := fset.Position(edit.Pos).Offset, fset.Position(edit.End).Offset
+			fixed = fixed[:start] + string(edit.NewText) + fixed[end:]
+		}
+		assert.Contains(t, fixed, "\t\"log/slog\"\n\t\"github.com/kubernetes-csi/csi-lib-utils/protosanitizer\"\n)")
+		assert.Contains(t, fixed, `fmt.Printf("%v %s", protosanitizer.StripSecrets(req), req.Name)`)
+	}
+}
+
+// TestSuggestedFixes checks the fixed files against the golden files
+// in testdata, in particular how the import gets added.
+func TestSuggestedFixes(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), Analyzer, "grouped", "single", "oneline")
+}
@@ -0,0 +1,14 @@
+package single
+
+import "fmt"
+
+type Request struct {
+	Name    string            `protobuf:"bytes,1,opt,name=name,proto3"`
+	Secrets map[string]string `protobuf:"bytes,2,rep,name=secrets,proto3"`
+}
+
+func (*Request) ProtoMessage() {}
+
+func f(req *Request) {
+	fmt.Printf("%v %s", req, req.Name) // want `\*single.Request may contain secrets and is passed to fmt.Printf without protosanitizer.StripSecrets`
+}
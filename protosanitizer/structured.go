@@ -0,0 +1,198 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log/slog"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+)
+
+// LogValue implements slog.LogValuer. Messages become a group with
+// one attribute per field, nested messages and maps become nested
+// groups and repeated fields become slices. Other values are
+// logged as the string produced by String. WithMaxSize does not
+// apply because there is no serialized output to cut off, use
+// WithMaxEntries and WithMaxStringLength instead.
+func (s *stripSecrets) LogValue() slog.Value {
+	root := s.structured()
+	if root == nil {
+		return slog.StringValue(s.String())
+	}
+	return slog.GroupValue(root.attrs()...)
+}
+
+// MarshalLog implements logr.Marshaler. Messages become a
+// map[string]interface{}, with the same nesting and limits as in
+// LogValue. Other values are logged as the string produced by String.
+func (s *stripSecrets) MarshalLog() interface{} {
+	root := s.structured()
+	if root == nil {
+		return s.String()
+	}
+	return root.plain()
+}
+
+// structured walks the message and returns the sanitized fields,
+// or nil if the value is not a message.
+func (s *stripSecrets) structured() *object {
+	switch msg := s.msg.(type) {
+	case protov2.Message:
+	case proto.Message:
+		if noDescriptor(msg) != nil && s.sanitizer.strict {
+			// String writes the marker.
+			return nil
+		}
+	default:
+		return nil
+	}
+	f := &structuredFormat{stack: []*object{{}}}
+	e := s.sanitizer.newEncoder(&bytes.Buffer{})
+	e.tree = f
+	e.treeValueOf(reflect.ValueOf(s.msg))
+	return f.stack[0]
+}
+
+// object holds the fields of a message or the entries of a map,
+// in the order in which they were walked.
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+// add stores a value, which is a scalar, *object or []interface{}.
+// Repeated fields get collected in a slice.
+func (o *object) add(k treeKey, v interface{}) {
+	if k.index > 0 {
+		last := len(o.values) - 1
+		o.values[last] = append(o.values[last].([]interface{}), v)
+		return
+	}
+	key := k.name
+	if k.mapKey != nil {
+		key = k.mapKey.text
+	}
+	if k.index == 0 {
+		v = []interface{}{v}
+	}
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, v)
+}
+
+func (o *object) attrs() []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(o.keys))
+	for i, key := range o.keys {
+		var value slog.Value
+		switch v := o.values[i].(type) {
+		case *object:
+			value = slog.GroupValue(v.attrs()...)
+		case []interface{}:
+			value = slog.AnyValue(plain(v))
+		default:
+			value = slog.AnyValue(v)
+		}
+		attrs = append(attrs, slog.Attr{Key: key, Value: value})
+	}
+	return attrs
+}
+
+func (o *object) plain() map[string]interface{} {
+	m := make(map[string]interface{}, len(o.keys))
+	for i, key := range o.keys {
+		m[key] = plain(o.values[i])
+	}
+	return m
+}
+
+// plain converts the content of an object into maps and slices.
+func plain(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *object:
+		return v.plain()
+	case []interface{}:
+		values := make([]interface{}, 0, len(v))
+		for _, value := range v {
+			values = append(values, plain(value))
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+// structuredFormat collects values instead of writing them, for
+// LogValue and MarshalLog.
+type structuredFormat struct {
+	// stack has the root object at the bottom and the
+	// message or map that currently gets walked at the top.
+	stack []*object
+}
+
+func (f *structuredFormat) top() *object {
+	return f.stack[len(f.stack)-1]
+}
+
+func (f *structuredFormat) scalar(e *encoder, k treeKey, v treeValue) {
+	f.top().add(k, nativeValue(v))
+}
+
+func (f *structuredFormat) beginMessage(e *encoder, k treeKey) {
+	f.stack = append(f.stack, &object{})
+}
+
+func (f *structuredFormat) endMessage(e *encoder, k treeKey) {
+	o := f.top()
+	f.stack = f.stack[:len(f.stack)-1]
+	f.top().add(k, o)
+}
+
+func (f *structuredFormat) beginMap(e *encoder, k treeKey) { f.beginMessage(e, k) }
+func (f *structuredFormat) endMap(e *encoder, k treeKey)   { f.endMessage(e, k) }
+
+// nativeValue converts a scalar back into a Go value, so that
+// numbers and booleans are logged as such. Enum names remain
+// strings, bytes become base64 strings like in JSON.
+func nativeValue(v treeValue) interface{} {
+	switch v.kind {
+	case textValue:
+		return v.text + v.suffix
+	case binaryValue:
+		return base64.StdEncoding.EncodeToString([]byte(v.text)) + v.suffix
+	}
+	if i, err := strconv.ParseInt(v.text, 10, 64); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(v.text, 10, 64); err == nil {
+		return u
+	}
+	if f, err := strconv.ParseFloat(v.text, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f
+	}
+	switch v.text {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return v.text
+}
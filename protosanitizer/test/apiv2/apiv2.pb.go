@@ -0,0 +1,285 @@
+// Messages for testing code generated by protoc-gen-go for
+// google.golang.org/protobuf (APIv2).
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: github.com/kubernetes-csi/csi-lib-utils/protosanitizer/test/apiv2.proto
+
+package apiv2
+
+import (
+	_ "github.com/kubernetes-csi/csi-lib-utils/protosanitizer/test/csi10"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LoginRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	User         string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Password     string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	Parameters   map[string]string      `protobuf:"bytes,3,rep,name=parameters,proto3" json:"parameters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	LoginSecrets map[string]string      `protobuf:"bytes,4,rep,name=login_secrets,json=loginSecrets,proto3" json:"login_secrets,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Keys         []*Key                 `protobuf:"bytes,5,rep,name=keys,proto3" json:"keys,omitempty"`
+	// Types that are valid to be assigned to Credentials:
+	//
+	//	*LoginRequest_Token
+	//	*LoginRequest_Key
+	Credentials   isLoginRequest_Credentials `protobuf_oneof:"credentials"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginRequest) Reset() {
+	*x = LoginRequest{}
+	mi := &file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRequest) ProtoMessage() {}
+
+func (x *LoginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRequest.ProtoReflect.Descriptor instead.
+func (*LoginRequest) Descriptor() ([]byte, []int) {
+	return file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LoginRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetParameters() map[string]string {
+	if x != nil {
+		return x.Parameters
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetLoginSecrets() map[string]string {
+	if x != nil {
+		return x.LoginSecrets
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetKeys() []*Key {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetCredentials() isLoginRequest_Credentials {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetToken() string {
+	if x != nil {
+		if x, ok := x.Credentials.(*LoginRequest_Token); ok {
+			return x.Token
+		}
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetKey() *Key {
+	if x != nil {
+		if x, ok := x.Credentials.(*LoginRequest_Key); ok {
+			return x.Key
+		}
+	}
+	return nil
+}
+
+type isLoginRequest_Credentials interface {
+	isLoginRequest_Credentials()
+}
+
+type LoginRequest_Token struct {
+	Token string `protobuf:"bytes,6,opt,name=token,proto3,oneof"`
+}
+
+type LoginRequest_Key struct {
+	Key *Key `protobuf:"bytes,7,opt,name=key,proto3,oneof"`
+}
+
+func (*LoginRequest_Token) isLoginRequest_Credentials() {}
+
+func (*LoginRequest_Key) isLoginRequest_Credentials() {}
+
+type Key struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Key) Reset() {
+	*x = Key{}
+	mi := &file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Key) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Key) ProtoMessage() {}
+
+func (x *Key) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Key.ProtoReflect.Descriptor instead.
+func (*Key) Descriptor() ([]byte, []int) {
+	return file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Key) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Key) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto protoreflect.FileDescriptor
+
+const file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDesc = "" +
+	"\n" +
+	"Ggithub.com/kubernetes-csi/csi-lib-utils/protosanitizer/test/apiv2.proto\x12\fapiv2test.v1\x1aEgithub.com/kubernetes-csi/csi-lib-utils/protosanitizer/test/csi.proto\"\xdc\x03\n" +
+	"\fLoginRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12\x1f\n" +
+	"\bpassword\x18\x02 \x01(\tB\x03\x98B\x01R\bpassword\x12J\n" +
+	"\n" +
+	"parameters\x18\x03 \x03(\v2*.apiv2test.v1.LoginRequest.ParametersEntryR\n" +
+	"parameters\x12Q\n" +
+	"\rlogin_secrets\x18\x04 \x03(\v2,.apiv2test.v1.LoginRequest.LoginSecretsEntryR\floginSecrets\x12%\n" +
+	"\x04keys\x18\x05 \x03(\v2\x11.apiv2test.v1.KeyR\x04keys\x12\x1b\n" +
+	"\x05token\x18\x06 \x01(\tB\x03\x98B\x01H\x00R\x05token\x12%\n" +
+	"\x03key\x18\a \x01(\v2\x11.apiv2test.v1.KeyH\x00R\x03key\x1a=\n" +
+	"\x0fParametersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a?\n" +
+	"\x11LoginSecretsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\r\n" +
+	"\vcredentials\"2\n" +
+	"\x03Key\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x17\n" +
+	"\x04data\x18\x02 \x01(\fB\x03\x98B\x01R\x04dataBCZAgithub.com/kubernetes-csi/csi-lib-utils/protosanitizer/test/apiv2b\x06proto3"
+
+var (
+	file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescOnce sync.Once
+	file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescData []byte
+)
+
+func file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescGZIP() []byte {
+	file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescOnce.Do(func() {
+		file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDesc), len(file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDesc)))
+	})
+	return file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDescData
+}
+
+var file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_goTypes = []any{
+	(*LoginRequest)(nil), // 0: apiv2test.v1.LoginRequest
+	(*Key)(nil),          // 1: apiv2test.v1.Key
+	nil,                  // 2: apiv2test.v1.LoginRequest.ParametersEntry
+	nil,                  // 3: apiv2test.v1.LoginRequest.LoginSecretsEntry
+}
+var file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_depIdxs = []int32{
+	2, // 0: apiv2test.v1.LoginRequest.parameters:type_name -> apiv2test.v1.LoginRequest.ParametersEntry
+	3, // 1: apiv2test.v1.LoginRequest.login_secrets:type_name -> apiv2test.v1.LoginRequest.LoginSecretsEntry
+	1, // 2: apiv2test.v1.LoginRequest.keys:type_name -> apiv2test.v1.Key
+	1, // 3: apiv2test.v1.LoginRequest.key:type_name -> apiv2test.v1.Key
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_init() }
+func file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_init() {
+	if File_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto != nil {
+		return
+	}
+	file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_msgTypes[0].OneofWrappers = []any{
+		(*LoginRequest_Token)(nil),
+		(*LoginRequest_Key)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDesc), len(file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_goTypes,
+		DependencyIndexes: file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_depIdxs,
+		MessageInfos:      file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_msgTypes,
+	}.Build()
+	File_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto = out.File
+	file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_goTypes = nil
+	file_github_com_kubernetes_csi_csi_lib_utils_protosanitizer_test_apiv2_proto_depIdxs = nil
+}
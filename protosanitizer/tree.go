@@ -0,0 +1,300 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// treeFormat is implemented by the output formats which are produced
+// by walking a message with treeMessage: prototext, logfmt and YAML.
+// The walk takes care of finding and replacing secrets and of the
+// limits, the format only decides how the result is written.
+type treeFormat interface {
+	// scalar writes a single value.
+	scalar(e *encoder, k treeKey, v treeValue)
+	// beginMessage and endMessage surround the fields of a
+	// nested message.
+	beginMessage(e *encoder, k treeKey)
+	endMessage(e *encoder, k treeKey)
+	// beginMap and endMap surround the entries of a map field.
+	beginMap(e *encoder, k treeKey)
+	endMap(e *encoder, k treeKey)
+}
+
+// treeKey identifies a value inside its message.
+type treeKey struct {
+	// name is the name of the field.
+	name string
+	// index is the position inside a repeated field, -1 otherwise.
+	index int
+	// mapKey is set for the entries of a map field.
+	mapKey *treeValue
+}
+
+// treeValue is a scalar value, already converted to text.
+type treeValue struct {
+	text string
+	kind valueKind
+	// suffix gets appended to the formatted text, inside
+	// the quotes if there are any. It is used for
+	// the "...(N more bytes)" placeholder.
+	suffix string
+}
+
+type valueKind int
+
+const (
+	// literalValue is a number, boolean or enum name.
+	literalValue valueKind = iota
+	// textValue is a string, including markers and placeholders.
+	textValue
+	// binaryValue is the content of a bytes field.
+	binaryValue
+)
+
+func text(s string) treeValue {
+	return treeValue{text: s, kind: textValue}
+}
+
+// newTreeFormat returns the implementation of the format or nil
+// if it is not based on treeFormat.
+func newTreeFormat(format Format) treeFormat {
+	switch format {
+	case FormatText:
+		return &textFormat{}
+	case FormatLogfmt:
+		return &logfmtFormat{}
+	case FormatYAML:
+		return &yamlFormat{}
+	}
+	return nil
+}
+
+// treeValueOf serializes an arbitrary value passed to StripSecrets.
+// Values which are not messages are serialized as JSON.
+func (e *encoder) treeValueOf(v reflect.Value) {
+	if !v.IsValid() {
+		e.buf.WriteString("null")
+		return
+	}
+	// The top-level message counts towards the maximum depth,
+	// like in the other formats.
+	e.depth++
+	switch msg := v.Interface().(type) {
+	case protov2.Message:
+		e.treeMessage(msg.ProtoReflect())
+	case proto.Message:
+		if err := noDescriptor(msg); err != nil && e.strict {
+			e.stripped(err)
+		} else {
+			e.treeMessage(protoimpl.X.MessageOf(msg))
+		}
+	default:
+		e.marshal(v)
+	}
+	e.depth--
+}
+
+// treeMessage writes the fields of a message in declaration order.
+func (e *encoder) treeMessage(m protoreflect.Message) {
+	if m == nil || !m.IsValid() {
+		return
+	}
+	if isAny(m.Descriptor()) {
+		e.treeAny(m)
+		return
+	}
+	// The plan for proto3 JSON has all fields in the right order.
+	plan := e.rules.protoJSONPlan(m.Descriptor())
+	for i := range plan.entries {
+		if e.stop() {
+			break
+		}
+		entry := &plan.entries[i]
+		if !m.Has(entry.field) {
+			continue
+		}
+		e.treeField(entry, m.Get(entry.field))
+	}
+}
+
+func (e *encoder) treeField(entry *reflectEntry, v protoreflect.Value) {
+	field := entry.field
+	k := treeKey{name: string(field.Name()), index: -1}
+	switch {
+	case entry.secret:
+		e.treeSecret(k, field, v)
+	case entry.err != nil && e.strict:
+		e.tree.scalar(e, k, text(fmt.Sprintf("***stripped: %s***", entry.err)))
+	case field.IsList():
+		list := v.List()
+		n := e.entries(list.Len())
+		for i := 0; i < n; i++ {
+			if e.stop() {
+				break
+			}
+			k.index = i
+			e.treeItem(k, field, list.Get(i))
+		}
+		if n < list.Len() {
+			k.index = n
+			e.tree.scalar(e, k, text(fmt.Sprintf("...(%d more entries)", list.Len()-n)))
+		}
+	case field.IsMap():
+		m := v.Map()
+		keys := e.mapKeys(field, m)
+		n := e.entries(len(keys))
+		e.tree.beginMap(e, k)
+		for _, key := range keys[:n] {
+			if e.stop() {
+				break
+			}
+			mapKey := treeMapKey(field, key)
+			entryKey := treeKey{name: k.name, index: -1, mapKey: &mapKey}
+			value := m.Get(key)
+			reason := ""
+			if e.heuristics != nil {
+				reason = e.heuristics.key(key.String())
+			}
+			switch {
+			case entry.keys != nil && entry.keys.secret(key.String()):
+				e.tree.scalar(e, entryKey, text(e.redacted(field.MapValue(), value)))
+			case reason != "":
+				e.tree.scalar(e, entryKey, text("***stripped: "+reason+"***"))
+			default:
+				e.treeItem(entryKey, field.MapValue(), value)
+			}
+		}
+		if n < len(keys) {
+			more := text("...")
+			e.tree.scalar(e, treeKey{name: k.name, index: -1, mapKey: &more}, text(fmt.Sprintf("...(%d more entries)", len(keys)-n)))
+		}
+		e.tree.endMap(e, k)
+	default:
+		e.treeItem(k, field, v)
+	}
+}
+
+// treeItem writes a single value, which may be a message.
+func (e *encoder) treeItem(k treeKey, field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	if !isMessage(field) {
+		e.tree.scalar(e, k, e.treeScalar(field, v))
+		return
+	}
+	e.treeNested(k, v.Message())
+}
+
+// treeNested writes a message which is stored in a field.
+func (e *encoder) treeNested(k treeKey, m protoreflect.Message) {
+	if e.maxDepth > 0 && e.depth >= e.maxDepth {
+		e.tree.scalar(e, k, text("...(max depth)"))
+		return
+	}
+	if v, ok := e.treeWellKnown(m); ok {
+		e.tree.scalar(e, k, v)
+		return
+	}
+	e.depth++
+	e.tree.beginMessage(e, k)
+	e.treeMessage(m)
+	e.tree.endMessage(e, k)
+	e.depth--
+}
+
+// treeSecret writes the replacement for the value of a secret field.
+func (e *encoder) treeSecret(k treeKey, field protoreflect.FieldDescriptor, v protoreflect.Value) {
+	switch {
+	case field.IsMap() && e.redactor != nil && e.redactor.MapKeys():
+		m := v.Map()
+		keys := e.mapKeys(field, m)
+		n := e.entries(len(keys))
+		e.tree.beginMap(e, k)
+		for _, key := range keys[:n] {
+			if e.stop() {
+				break
+			}
+			mapKey := treeMapKey(field, key)
+			e.tree.scalar(e, treeKey{name: k.name, index: -1, mapKey: &mapKey}, text(e.redacted(field.MapValue(), m.Get(key))))
+		}
+		if n < len(keys) {
+			more := text("...")
+			e.tree.scalar(e, treeKey{name: k.name, index: -1, mapKey: &more}, text(fmt.Sprintf("...(%d more entries)", len(keys)-n)))
+		}
+		e.tree.endMap(e, k)
+	case (field.IsMap() || field.IsList()) && e.redactor != nil:
+		e.tree.scalar(e, k, text(e.redactor.Redact(nil)))
+	case field.IsMap() || field.IsList():
+		e.tree.scalar(e, k, text(defaultMarker))
+	default:
+		e.tree.scalar(e, k, text(e.redacted(field, v)))
+	}
+}
+
+func treeMapKey(field protoreflect.FieldDescriptor, key protoreflect.MapKey) treeValue {
+	if field.MapKey().Kind() == protoreflect.StringKind {
+		return text(key.String())
+	}
+	return treeValue{text: key.String(), kind: literalValue}
+}
+
+// treeScalar converts a value which is not a message to text,
+// applying the heuristics and the maximum string length.
+func (e *encoder) treeScalar(field protoreflect.FieldDescriptor, v protoreflect.Value) treeValue {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return treeValue{text: strconv.FormatBool(v.Bool())}
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return treeValue{text: string(value.Name())}
+		}
+		return treeValue{text: strconv.FormatInt(int64(v.Enum()), 10)}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return treeValue{text: strconv.FormatInt(v.Int(), 10)}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return treeValue{text: strconv.FormatUint(v.Uint(), 10)}
+	case protoreflect.FloatKind:
+		return treeValue{text: strconv.FormatFloat(v.Float(), 'g', -1, 32)}
+	case protoreflect.DoubleKind:
+		return treeValue{text: strconv.FormatFloat(v.Float(), 'g', -1, 64)}
+	case protoreflect.StringKind:
+		s := v.String()
+		if e.heuristics != nil {
+			if reason := e.heuristics.value(s); reason != "" {
+				return text("***stripped: " + reason + "***")
+			}
+		}
+		s, suffix := e.shorten(s)
+		return treeValue{text: s, kind: textValue, suffix: suffix}
+	case protoreflect.BytesKind:
+		b := v.Bytes()
+		if e.maxStringLength > 0 && len(b) > e.maxStringLength {
+			return treeValue{text: string(b[:e.maxStringLength]), kind: binaryValue, suffix: fmt.Sprintf("...(%d more bytes)", len(b)-e.maxStringLength)}
+		}
+		return treeValue{text: string(b), kind: binaryValue}
+	}
+	return treeValue{text: "null"}
+}
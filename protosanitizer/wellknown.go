@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protosanitizer
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// isWellKnown checks whether the message is one of the well-known
+// types which have a more readable representation than their fields:
+// Any, Timestamp, Duration and the wrapper types. Outside of proto3
+// JSON, they get serialized by wellKnown and treeWellKnown.
+func isWellKnown(name protoreflect.FullName) bool {
+	switch name {
+	case anyName,
+		"google.protobuf.Timestamp", "google.protobuf.Duration",
+		"google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
+
+// wellKnown serializes the message if it is one of the types accepted
+// by isWellKnown: a Timestamp as RFC 3339 string, a Duration like
+// "1.5s", a wrapper as the value inside it and an Any with
+// anyMessage. It returns false for all other messages.
+//
+// Timestamps and durations use the short form of timeText. The
+// proto3 JSON output uses protoJSONWellKnown instead, which keeps
+// the canonical 3, 6 or 9 fractional digits.
+func (e *encoder) wellKnown(m protoreflect.Message) bool {
+	md := m.Descriptor()
+	if !isWellKnown(md.FullName()) {
+		return false
+	}
+	switch md.Name() {
+	case "Any":
+		e.anyMessage(m)
+	case "Timestamp", "Duration":
+		e.string(timeText(m, true))
+	default:
+		value := md.Fields().ByName("value")
+		e.reflectValue(value, m.Get(value))
+	}
+	return true
+}
+
+// treeWellKnown is the counterpart of wellKnown for the formats based
+// on treeFormat. Any is not handled here because it does not get
+// converted into a single value.
+func (e *encoder) treeWellKnown(m protoreflect.Message) (treeValue, bool) {
+	md := m.Descriptor()
+	if !isWellKnown(md.FullName()) {
+		return treeValue{}, false
+	}
+	switch md.Name() {
+	case "Any":
+		return treeValue{}, false
+	case "Timestamp", "Duration":
+		return text(timeText(m, true)), true
+	default:
+		value := md.Fields().ByName("value")
+		return e.treeScalar(value, m.Get(value)), true
+	}
+}
+
+// timeText formats a Timestamp or Duration like proto3 JSON. If
+// short is true, all trailing zeros of the fraction get removed,
+// so one and a half seconds become "1.5s" instead of "1.500s".
+// The short form is used by all formats except FormatProtoJSON,
+// where the canonical form is required.
+func timeText(m protoreflect.Message, short bool) string {
+	md := m.Descriptor()
+	fields := md.Fields()
+	seconds := m.Get(fields.ByName("seconds")).Int()
+	nanos := int32(m.Get(fields.ByName("nanos")).Int())
+	s := formatDuration(seconds, nanos)
+	if md.Name() == "Timestamp" {
+		s = formatTimestamp(seconds, nanos)
+	}
+	if !short || !strings.Contains(s, ".") {
+		return s
+	}
+	suffix := s[len(s)-1:]
+	s = strings.TrimRight(s[:len(s)-1], "0")
+	return strings.TrimSuffix(s, ".") + suffix
+}